@@ -0,0 +1,47 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type AuditLogResponse struct {
+	ID         string      `json:"id"`
+	ActorID    *string     `json:"actor_id"`
+	ActorLogin string      `json:"actor_login"`
+	Action     string      `json:"action"`
+	EntityType string      `json:"entity_type"`
+	EntityID   string      `json:"entity_id"`
+	Diff       models.JSON `json:"diff"`
+	IP         string      `json:"ip"`
+	CreatedAt  time.Time   `json:"created"`
+}
+
+func NewAuditLogList(entries []models.AuditLog) []AuditLogResponse {
+	res := make([]AuditLogResponse, 0, len(entries))
+	for _, e := range entries {
+		item := AuditLogResponse{
+			ID:         e.ID,
+			ActorID:    e.ActorID,
+			Action:     e.Action,
+			EntityType: e.EntityType,
+			EntityID:   e.EntityID,
+			Diff:       e.Diff,
+			IP:         e.IP,
+			CreatedAt:  e.CreatedAt,
+		}
+		if e.Actor != nil {
+			item.ActorLogin = e.Actor.Login
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+type AuditPage struct {
+	Items []AuditLogResponse `json:"items"`
+	Page  int                `json:"page"`
+	Limit int                `json:"limit"`
+	Total int64              `json:"total"`
+}
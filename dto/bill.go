@@ -0,0 +1,100 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+// BillShareInput assigns Numerator/Denominator of an order line to a bill;
+// both default to 1, the whole line.
+type BillShareInput struct {
+	OrderFoodID string `json:"order_food_id" validate:"required"`
+	Numerator   uint   `json:"numerator" validate:"omitempty,max=100"`
+	Denominator uint   `json:"denominator" validate:"omitempty,max=100"`
+}
+
+type BillInput struct {
+	Label string           `json:"label" validate:"max=64"`
+	Items []BillShareInput `json:"items" validate:"dive"`
+}
+
+// BillSplitInput splits one order, or every open order of a table, either
+// into Parts equal bills or into the listed Bills, which together must cover
+// every line exactly once.
+type BillSplitInput struct {
+	OrderID string           `json:"order_id" validate:"required_without=TableID,excluded_with=TableID"`
+	TableID string           `json:"table_id"`
+	Mode    models.SplitMode `json:"mode" validate:"required,oneof=equal items"`
+	Parts   int              `json:"parts" validate:"omitempty,min=2,max=20"`
+	Bills   []BillInput      `json:"bills" validate:"omitempty,min=2,max=20,dive"`
+}
+
+type BillLineResponse struct {
+	OrderFoodID string `json:"order_food_id"`
+	Numerator   uint   `json:"numerator"`
+	Denominator uint   `json:"denominator"`
+	Amount      uint   `json:"amount"`
+}
+
+type BillResponse struct {
+	ID       string             `json:"id"`
+	Label    string             `json:"label"`
+	Subtotal uint               `json:"subtotal"`
+	Lines    []BillLineResponse `json:"lines"`
+	PaymentsResponse
+}
+
+type BillSplitResponse struct {
+	ID          string           `json:"id"`
+	TableID     string           `json:"table_id"`
+	Mode        models.SplitMode `json:"mode"`
+	Total       uint             `json:"total"`
+	OrderIDs    []string         `json:"order_ids"`
+	Bills       []BillResponse   `json:"bills"`
+	CancelledAt *time.Time       `json:"cancelled_at"`
+	CreatedAt   time.Time        `json:"created"`
+}
+
+// NewBillSplit expects Orders and Bills with their Lines preloaded and the
+// payments of the split's bills in payments.
+func NewBillSplit(s models.BillSplit, payments []models.Payment) BillSplitResponse {
+	res := BillSplitResponse{
+		ID:          s.ID,
+		TableID:     s.TableID,
+		Mode:        s.Mode,
+		Total:       s.Total,
+		OrderIDs:    make([]string, 0, len(s.Orders)),
+		Bills:       make([]BillResponse, 0, len(s.Bills)),
+		CancelledAt: s.CancelledAt,
+		CreatedAt:   s.CreatedAt,
+	}
+	for _, o := range s.Orders {
+		res.OrderIDs = append(res.OrderIDs, o.ID)
+	}
+	for _, b := range s.Bills {
+		var own []models.Payment
+		for _, p := range payments {
+			if p.BillID != nil && *p.BillID == b.ID {
+				own = append(own, p)
+			}
+		}
+		bill := BillResponse{
+			ID:               b.ID,
+			Label:            b.Label,
+			Subtotal:         b.Subtotal,
+			Lines:            make([]BillLineResponse, 0, len(b.Lines)),
+			PaymentsResponse: NewPayments(b.Amount, own),
+		}
+		for _, l := range b.Lines {
+			bill.Lines = append(bill.Lines, BillLineResponse{
+				OrderFoodID: l.OrderFoodID,
+				Numerator:   l.Numerator,
+				Denominator: l.Denominator,
+				Amount:      l.Amount,
+			})
+		}
+		res.Bills = append(res.Bills, bill)
+	}
+	return res
+}
@@ -0,0 +1,54 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type CategoryInput struct {
+	NameUz string `json:"name_uz" validate:"required"`
+	NameRu string `json:"name_ru" validate:"required"`
+	NameEn string `json:"name_en" validate:"required"`
+}
+
+func (in CategoryInput) Apply(c *models.Category) {
+	c.NameUz = in.NameUz
+	c.NameRu = in.NameRu
+	c.NameEn = in.NameEn
+}
+
+type CategoryResponse struct {
+	ID        string         `json:"id"`
+	NameUz    string         `json:"name_uz"`
+	NameRu    string         `json:"name_ru"`
+	NameEn    string         `json:"name_en"`
+	Name      string         `json:"name"`
+	Foods     []FoodResponse `json:"foods"`
+	CreatedAt time.Time      `json:"created"`
+	UpdatedAt time.Time      `json:"updated"`
+}
+
+func NewCategory(c models.Category) CategoryResponse {
+	res := CategoryResponse{
+		ID:        c.ID,
+		NameUz:    c.NameUz,
+		NameRu:    c.NameRu,
+		NameEn:    c.NameEn,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+	if c.Foods != nil {
+		res.Foods = NewFoodList(c.Foods)
+	}
+	return res
+}
+
+func NewCategoryList(categories []models.Category) []CategoryResponse {
+	res := make([]CategoryResponse, 0, len(categories))
+	for _, c := range categories {
+		res = append(res, NewCategory(c))
+	}
+	return res
+}
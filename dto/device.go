@@ -0,0 +1,74 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type DeviceInput struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type DeviceResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Active     bool       `json:"active"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time  `json:"created"`
+}
+
+func NewDevice(d models.Device) DeviceResponse {
+	return DeviceResponse{
+		ID:         d.ID,
+		Name:       d.Name,
+		Active:     d.Active,
+		LastSeenAt: d.LastSeenAt,
+		CreatedAt:  d.CreatedAt,
+	}
+}
+
+func NewDeviceList(devices []models.Device) []DeviceResponse {
+	res := make([]DeviceResponse, 0, len(devices))
+	for _, d := range devices {
+		res = append(res, NewDevice(d))
+	}
+	return res
+}
+
+// RegisteredDeviceResponse is returned once, when the device is created. The
+// token cannot be read again afterwards.
+type RegisteredDeviceResponse struct {
+	DeviceResponse
+	Token string `json:"token"`
+}
+
+type PinLoginInput struct {
+	UserID string `json:"user_id" validate:"required"`
+	Pin    string `json:"pin" validate:"required,pin"`
+}
+
+type PinLoginResponse struct {
+	Token     string        `json:"token"`
+	ExpiresIn int64         `json:"expires_in"`
+	User      StaffResponse `json:"user"`
+}
+
+// DeviceStaffResponse is the tile a tablet shows so staff can pick
+// themselves before typing their PIN.
+type DeviceStaffResponse struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+}
+
+func NewDeviceStaffList(users []models.User) []DeviceStaffResponse {
+	res := make([]DeviceStaffResponse, 0, len(users))
+	for _, u := range users {
+		name := u.DisplayName
+		if name == "" {
+			name = u.Login
+		}
+		res = append(res, DeviceStaffResponse{ID: u.ID, DisplayName: name})
+	}
+	return res
+}
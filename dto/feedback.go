@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type FeedbackInput struct {
+	OrderID  string `json:"order_id"`
+	Feedback string `json:"feedback"`
+	Region   string `json:"region"`
+	Star     uint   `json:"star" validate:"required,min=1,max=5"`
+}
+
+func (in FeedbackInput) Model(tableID string) models.Feedback {
+	return models.Feedback{
+		TableID:  tableID,
+		OrderID:  in.OrderID,
+		Feedback: in.Feedback,
+		Region:   in.Region,
+		Star:     in.Star,
+	}
+}
+
+type FeedbackResponse struct {
+	ID        string         `json:"id"`
+	TableID   string         `json:"table_id"`
+	Table     *TableResponse `json:"table,omitempty"`
+	Feedback  string         `json:"feedback"`
+	OrderID   string         `json:"order_id"`
+	Region    string         `json:"region"`
+	Star      uint           `json:"star"`
+	CreatedAt time.Time      `json:"created"`
+}
+
+func NewFeedback(f models.Feedback) FeedbackResponse {
+	res := FeedbackResponse{
+		ID:        f.ID,
+		TableID:   f.TableID,
+		Feedback:  f.Feedback,
+		OrderID:   f.OrderID,
+		Region:    f.Region,
+		Star:      f.Star,
+		CreatedAt: f.CreatedAt,
+	}
+	if f.Table.ID != "" {
+		table := NewTable(f.Table)
+		res.Table = &table
+	}
+	return res
+}
+
+func NewFeedbackList(feedbacks []models.Feedback) []FeedbackResponse {
+	res := make([]FeedbackResponse, 0, len(feedbacks))
+	for _, f := range feedbacks {
+		res = append(res, NewFeedback(f))
+	}
+	return res
+}
@@ -0,0 +1,89 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type FoodInput struct {
+	NameUz        string  `json:"name_uz" validate:"required"`
+	NameRu        string  `json:"name_ru" validate:"required"`
+	NameEn        string  `json:"name_en" validate:"required"`
+	DescriptionUz string  `json:"description_uz" validate:"required"`
+	DescriptionRu string  `json:"description_ru" validate:"required"`
+	DescriptionEn string  `json:"description_en" validate:"required"`
+	Price         uint    `json:"price" validate:"required"`
+	ImageUrl      string  `json:"image_url" validate:"required"`
+	Weight        float32 `json:"weight" validate:"required"`
+	WeightType    string  `json:"weight_type" validate:"required"`
+	Available     *bool   `json:"available"`
+	CategoryID    string  `json:"category_id" validate:"required"`
+}
+
+func (in FoodInput) Apply(f *models.Food) {
+	f.NameUz = in.NameUz
+	f.NameRu = in.NameRu
+	f.NameEn = in.NameEn
+	f.DescriptionUz = in.DescriptionUz
+	f.DescriptionRu = in.DescriptionRu
+	f.DescriptionEn = in.DescriptionEn
+	f.Price = in.Price
+	f.ImageUrl = in.ImageUrl
+	f.Weight = in.Weight
+	f.WeightType = in.WeightType
+	if in.Available != nil {
+		f.Available = *in.Available
+	}
+	f.CategoryID = in.CategoryID
+}
+
+type FoodResponse struct {
+	ID            string    `json:"id"`
+	NameUz        string    `json:"name_uz"`
+	Name          string    `json:"name"`
+	NameRu        string    `json:"name_ru"`
+	NameEn        string    `json:"name_en"`
+	DescriptionUz string    `json:"description_uz"`
+	Description   string    `json:"description"`
+	DescriptionRu string    `json:"description_ru"`
+	DescriptionEn string    `json:"description_en"`
+	Price         uint      `json:"price"`
+	ImageUrl      string    `json:"image_url"`
+	Weight        float32   `json:"weight"`
+	WeightType    string    `json:"weight_type"`
+	Available     bool      `json:"available"`
+	CategoryID    string    `json:"category_id"`
+	CreatedAt     time.Time `json:"created"`
+	UpdatedAt     time.Time `json:"updated"`
+}
+
+func NewFood(f models.Food) FoodResponse {
+	return FoodResponse{
+		ID:            f.ID,
+		NameUz:        f.NameUz,
+		Name:          f.Name,
+		NameRu:        f.NameRu,
+		NameEn:        f.NameEn,
+		DescriptionUz: f.DescriptionUz,
+		Description:   f.Description,
+		DescriptionRu: f.DescriptionRu,
+		DescriptionEn: f.DescriptionEn,
+		Price:         f.Price,
+		ImageUrl:      f.ImageUrl,
+		Weight:        f.Weight,
+		WeightType:    f.WeightType,
+		Available:     f.Available,
+		CategoryID:    f.CategoryID,
+		CreatedAt:     f.CreatedAt,
+		UpdatedAt:     f.UpdatedAt,
+	}
+}
+
+func NewFoodList(foods []models.Food) []FoodResponse {
+	res := make([]FoodResponse, 0, len(foods))
+	for _, f := range foods {
+		res = append(res, NewFood(f))
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type NotePresetInput struct {
+	NameUz string `json:"name_uz" validate:"required,max=200"`
+	NameRu string `json:"name_ru" validate:"required,max=200"`
+	NameEn string `json:"name_en" validate:"required,max=200"`
+}
+
+func (in NotePresetInput) Apply(p *models.FoodNotePreset) {
+	p.NameUz = in.NameUz
+	p.NameRu = in.NameRu
+	p.NameEn = in.NameEn
+}
+
+type NotePresetResponse struct {
+	ID        string    `json:"id"`
+	FoodID    string    `json:"food_id"`
+	NameUz    string    `json:"name_uz"`
+	Name      string    `json:"name"`
+	NameRu    string    `json:"name_ru"`
+	NameEn    string    `json:"name_en"`
+	CreatedAt time.Time `json:"created"`
+}
+
+func NewNotePreset(p models.FoodNotePreset) NotePresetResponse {
+	return NotePresetResponse{
+		ID:        p.ID,
+		FoodID:    p.FoodID,
+		NameUz:    p.NameUz,
+		Name:      p.Name,
+		NameRu:    p.NameRu,
+		NameEn:    p.NameEn,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+func NewNotePresetList(presets []models.FoodNotePreset) []NotePresetResponse {
+	res := make([]NotePresetResponse, 0, len(presets))
+	for _, p := range presets {
+		res = append(res, NewNotePreset(p))
+	}
+	return res
+}
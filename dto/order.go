@@ -0,0 +1,237 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
+)
+
+// MaxQuantity is the most of one food a line can hold, as in the max= tags
+// below.
+const MaxQuantity = 99
+
+type OrderFoodInput struct {
+	FoodID   string `json:"food_id" validate:"required"`
+	Quantity uint   `json:"quantity" validate:"required,min=1,max=99"`
+	Note     string `json:"note" validate:"max=200"`
+}
+
+// OrderInput has no table: guests order for the table of their session.
+type OrderInput struct {
+	Foods []OrderFoodInput `json:"foods" validate:"required,min=1,dive"`
+	Note  string           `json:"note" validate:"max=500"`
+}
+
+// OrderNoteInput sets the staff note of an order; guests write theirs in
+// OrderInput.
+type OrderNoteInput struct {
+	Note string `json:"note" validate:"max=500"`
+}
+
+type OrderItemNoteInput struct {
+	Note string `json:"note" validate:"max=200"`
+}
+
+type OrderFoodResponse struct {
+	ID             string            `json:"id"`
+	OrderID        string            `json:"order_id"`
+	FoodID         string            `json:"food_id"`
+	Quantity       uint              `json:"quantity"`
+	NameUz         string            `json:"name_uz"`
+	NameRu         string            `json:"name_ru"`
+	NameEn         string            `json:"name_en"`
+	Name           string            `json:"name"`
+	DescriptionUz  string            `json:"description_uz"`
+	DescriptionRu  string            `json:"description_ru"`
+	DescriptionEn  string            `json:"description_en"`
+	Description    string            `json:"description"`
+	CategoryNameUz string            `json:"category_name_uz"`
+	CategoryNameRu string            `json:"category_name_ru"`
+	CategoryNameEn string            `json:"category_name_en"`
+	CategoryName   string            `json:"category_name"`
+	Price          uint              `json:"price"`
+	Image          string            `json:"image"`
+	Weight         float32           `json:"weight"`
+	WeightType     string            `json:"weight_type"`
+	Status         models.DishStatus `json:"status"`
+	Note           string            `json:"note"`
+	CookingAt      *time.Time        `json:"cooking_at"`
+	ReadyAt        *time.Time        `json:"ready_at"`
+	ServedAt       *time.Time        `json:"served_at"`
+	CreatedAt      time.Time         `json:"created"`
+	UpdatedAt      time.Time         `json:"updated"`
+}
+
+func NewOrderFood(f models.OrderFood) OrderFoodResponse {
+	return OrderFoodResponse{
+		ID:             f.ID,
+		OrderID:        f.OrderID,
+		FoodID:         f.FoodID,
+		Quantity:       f.Quantity,
+		NameUz:         f.NameUz,
+		NameRu:         f.NameRu,
+		NameEn:         f.NameEn,
+		Name:           f.Name,
+		DescriptionUz:  f.DescriptionUz,
+		DescriptionRu:  f.DescriptionRu,
+		DescriptionEn:  f.DescriptionEn,
+		Description:    f.Description,
+		CategoryNameUz: f.CategoryNameUz,
+		CategoryNameRu: f.CategoryNameRu,
+		CategoryNameEn: f.CategoryNameEn,
+		CategoryName:   f.CategoryName,
+		Price:          f.Price,
+		Image:          f.Image,
+		Weight:         f.Weight,
+		WeightType:     f.WeightType,
+		Note:           f.Note,
+		Status:         f.Status,
+		CookingAt:      f.CookingAt,
+		ReadyAt:        f.ReadyAt,
+		ServedAt:       f.ServedAt,
+		CreatedAt:      f.CreatedAt,
+		UpdatedAt:      f.UpdatedAt,
+	}
+}
+
+type OrderResponse struct {
+	ID             string              `json:"id"`
+	TableID        string              `json:"table_id"`
+	TableSessionID *string             `json:"table_session_id"`
+	OrderId        string              `json:"order_id"`
+	BusinessDay    string              `json:"business_day"`
+	Table          TableResponse       `json:"table"`
+	UserID         *string             `json:"user_id"`
+	Total          uint                `json:"total"`
+	Price          pricing.Breakdown   `json:"price"`
+	Status         models.OrderStatus  `json:"status"`
+	CancelReason   models.CancelReason `json:"cancel_reason,omitempty"`
+	Note           string              `json:"note"`
+	StaffNote      string              `json:"staff_note"`
+	CreatedAt      time.Time           `json:"created"`
+	UpdatedAt      time.Time           `json:"updated"`
+	Feedback       *FeedbackResponse   `json:"feedback"`
+	Foods          []OrderFoodResponse `json:"foods"`
+}
+
+func NewOrder(o models.Order) OrderResponse {
+	res := OrderResponse{
+		ID:             o.ID,
+		TableID:        o.TableID,
+		TableSessionID: o.TableSessionID,
+		OrderId:        o.OrderId,
+		BusinessDay:    o.BusinessDay.Format(time.DateOnly),
+		Table:          NewTable(o.Table),
+		UserID:         o.UserID,
+		Total:          o.Total,
+		Price:          o.Breakdown,
+		Status:         o.Status,
+		CancelReason:   o.CancelReason,
+		Note:           o.Note,
+		StaffNote:      o.StaffNote,
+		CreatedAt:      o.CreatedAt,
+		UpdatedAt:      o.UpdatedAt,
+	}
+	if o.Feedback != nil {
+		feedback := NewFeedback(*o.Feedback)
+		res.Feedback = &feedback
+	}
+	if o.OrderFood != nil {
+		res.Foods = make([]OrderFoodResponse, 0, len(o.OrderFood))
+		for _, f := range o.OrderFood {
+			res.Foods = append(res.Foods, NewOrderFood(f))
+		}
+	}
+	return res
+}
+
+func NewOrderList(orders []models.Order) []OrderResponse {
+	res := make([]OrderResponse, 0, len(orders))
+	for _, o := range orders {
+		res = append(res, NewOrder(o))
+	}
+	return res
+}
+
+// OrderStatusInput needs a reason when the status is cancelled or rejected.
+type OrderStatusInput struct {
+	Status models.OrderStatus  `json:"status" validate:"required"`
+	Reason models.CancelReason `json:"reason"`
+}
+
+type OrderStatusHistoryResponse struct {
+	ID         string              `json:"id"`
+	OrderID    string              `json:"order_id"`
+	From       models.OrderStatus  `json:"from"`
+	To         models.OrderStatus  `json:"to"`
+	Reason     models.CancelReason `json:"reason,omitempty"`
+	ActorID    *string             `json:"actor_id"`
+	ActorLogin string              `json:"actor_login"`
+	CreatedAt  time.Time           `json:"created"`
+}
+
+func NewOrderStatusHistoryList(history []models.OrderStatusHistory) []OrderStatusHistoryResponse {
+	res := make([]OrderStatusHistoryResponse, 0, len(history))
+	for _, h := range history {
+		item := OrderStatusHistoryResponse{
+			ID:        h.ID,
+			OrderID:   h.OrderID,
+			From:      h.From,
+			To:        h.To,
+			Reason:    h.Reason,
+			ActorID:   h.ActorID,
+			CreatedAt: h.CreatedAt,
+		}
+		if h.Actor != nil {
+			item.ActorLogin = h.Actor.Login
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+// OrderPage is one page of an order listing. NextCursor is empty on the last
+// page.
+type OrderPage struct {
+	Items      []OrderResponse `json:"items"`
+	Limit      int             `json:"limit"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+type OrderItemQuantityInput struct {
+	Quantity uint `json:"quantity" validate:"required,min=1,max=99"`
+}
+
+type OrderItemChange struct {
+	ID     string `json:"id"`
+	FoodID string `json:"food_id"`
+	From   uint   `json:"from"`
+	To     uint   `json:"to"`
+}
+
+// OrderItemsDiff lists the lines an edit added, removed or changed the
+// quantity of.
+type OrderItemsDiff struct {
+	Added   []OrderFoodResponse `json:"added,omitempty"`
+	Removed []OrderFoodResponse `json:"removed,omitempty"`
+	Changed []OrderItemChange   `json:"changed,omitempty"`
+}
+
+type OrderUpdatedEvent struct {
+	Order OrderResponse  `json:"order"`
+	Diff  OrderItemsDiff `json:"diff"`
+}
+
+type DishStatusInput struct {
+	Status models.DishStatus `json:"status" validate:"required"`
+}
+
+// DishStatusEvent tells waiters which dish to take out and the table which
+// dish is on its way.
+type DishStatusEvent struct {
+	OrderID     string             `json:"order_id"`
+	TableID     string             `json:"table_id"`
+	OrderStatus models.OrderStatus `json:"order_status"`
+	Item        OrderFoodResponse  `json:"item"`
+}
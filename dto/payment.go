@@ -0,0 +1,89 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/payments"
+)
+
+// PaymentInput starts a payment. Without an amount the payment covers what
+// is left of the order.
+type PaymentInput struct {
+	Method payments.Method `json:"method" validate:"required"`
+	Amount uint            `json:"amount"`
+}
+
+// ConfirmPaymentInput carries the slip number when staff confirm a card
+// payment.
+type ConfirmPaymentInput struct {
+	Reference string `json:"reference" validate:"max=64"`
+}
+
+type PaymentResponse struct {
+	ID          string          `json:"id"`
+	OrderID     *string         `json:"order_id"`
+	BillID      *string         `json:"bill_id"`
+	Amount      uint            `json:"amount"`
+	Method      payments.Method `json:"method"`
+	Provider    string          `json:"provider"`
+	ProviderRef string          `json:"provider_ref"`
+	PayURL      string          `json:"pay_url,omitempty"`
+	Status      payments.Status `json:"status"`
+	ActorID     *string         `json:"actor_id"`
+	SettledAt   *time.Time      `json:"settled_at"`
+	CreatedAt   time.Time       `json:"created"`
+	UpdatedAt   time.Time       `json:"updated"`
+}
+
+func NewPayment(p models.Payment) PaymentResponse {
+	return PaymentResponse{
+		ID:          p.ID,
+		OrderID:     p.OrderID,
+		BillID:      p.BillID,
+		Amount:      p.Amount,
+		Method:      p.Method,
+		Provider:    p.Provider,
+		ProviderRef: p.ProviderRef,
+		PayURL:      p.PayURL,
+		Status:      p.Status,
+		ActorID:     p.ActorID,
+		SettledAt:   p.SettledAt,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+func NewPaymentList(list []models.Payment) []PaymentResponse {
+	res := make([]PaymentResponse, 0, len(list))
+	for _, p := range list {
+		res = append(res, NewPayment(p))
+	}
+	return res
+}
+
+// PaymentsResponse lists the payments towards an order or a bill with the
+// amounts they cover.
+type PaymentsResponse struct {
+	Total       uint              `json:"total"`
+	Paid        uint              `json:"paid"`
+	Pending     uint              `json:"pending"`
+	Outstanding uint              `json:"outstanding"`
+	Payments    []PaymentResponse `json:"payments"`
+}
+
+func NewPayments(total uint, list []models.Payment) PaymentsResponse {
+	res := PaymentsResponse{Total: total, Payments: NewPaymentList(list)}
+	for _, p := range list {
+		switch p.Status {
+		case payments.StatusConfirmed:
+			res.Paid += p.Amount
+		case payments.StatusPending:
+			res.Pending += p.Amount
+		}
+	}
+	if res.Paid+res.Pending < res.Total {
+		res.Outstanding = res.Total - res.Paid - res.Pending
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type CancellationItem struct {
+	OrderID     string              `json:"order_id"`
+	OrderNumber string              `json:"order_number"`
+	TableNumber uint                `json:"table_number"`
+	Status      models.OrderStatus  `json:"status"`
+	Reason      models.CancelReason `json:"reason"`
+	Total       uint                `json:"total"`
+	ActorID     *string             `json:"actor_id"`
+	ActorLogin  string              `json:"actor_login"`
+	CancelledAt time.Time           `json:"cancelled_at"`
+}
+
+type CancellationSummary struct {
+	Reason models.CancelReason `json:"reason"`
+	Count  int                 `json:"count"`
+	Total  uint                `json:"total"`
+}
+
+type CancellationReport struct {
+	Count    int                   `json:"count"`
+	Total    uint                  `json:"total"`
+	ByReason []CancellationSummary `json:"by_reason"`
+	Items    []CancellationItem    `json:"items"`
+}
+
+// NewCancellationReport expects history entries with Order.Table and Actor
+// preloaded.
+func NewCancellationReport(history []models.OrderStatusHistory) CancellationReport {
+	report := CancellationReport{
+		ByReason: []CancellationSummary{},
+		Items:    make([]CancellationItem, 0, len(history)),
+	}
+	byReason := map[models.CancelReason]int{}
+	for _, h := range history {
+		item := CancellationItem{
+			OrderID:     h.OrderID,
+			OrderNumber: h.Order.OrderId,
+			TableNumber: h.Order.Table.Number,
+			Status:      h.To,
+			Reason:      h.Reason,
+			Total:       h.Order.Total,
+			ActorID:     h.ActorID,
+			CancelledAt: h.CreatedAt,
+		}
+		if h.Actor != nil {
+			item.ActorLogin = h.Actor.Login
+		}
+		report.Items = append(report.Items, item)
+		report.Count++
+		report.Total += item.Total
+		i, seen := byReason[h.Reason]
+		if !seen {
+			i = len(report.ByReason)
+			byReason[h.Reason] = i
+			report.ByReason = append(report.ByReason, CancellationSummary{Reason: h.Reason})
+		}
+		report.ByReason[i].Count++
+		report.ByReason[i].Total += item.Total
+	}
+	return report
+}
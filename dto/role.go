@@ -0,0 +1,53 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type RoleInput struct {
+	Name        string   `json:"name" validate:"required"`
+	Permissions []string `json:"permissions" validate:"dive,required"`
+}
+
+type PermissionResponse struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+func NewPermissionList(permissions []models.Permission) []PermissionResponse {
+	res := make([]PermissionResponse, 0, len(permissions))
+	for _, p := range permissions {
+		res = append(res, PermissionResponse{Code: p.Code, Description: p.Description})
+	}
+	return res
+}
+
+type RoleResponse struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	System      bool                 `json:"system"`
+	Permissions []PermissionResponse `json:"permissions"`
+	CreatedAt   time.Time            `json:"created"`
+	UpdatedAt   time.Time            `json:"updated"`
+}
+
+func NewRole(r models.Role) RoleResponse {
+	return RoleResponse{
+		ID:          r.ID,
+		Name:        r.Name,
+		System:      r.System,
+		Permissions: NewPermissionList(r.Permissions),
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
+
+func NewRoleList(roles []models.Role) []RoleResponse {
+	res := make([]RoleResponse, 0, len(roles))
+	for _, r := range roles {
+		res = append(res, NewRole(r))
+	}
+	return res
+}
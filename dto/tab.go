@@ -0,0 +1,88 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/payments"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
+)
+
+// CloseTabInput names how the rest of the tab was paid at the table. It can
+// be left out when every order is already paid.
+type CloseTabInput struct {
+	Method payments.Method `json:"method" validate:"omitempty,oneof=cash card"`
+}
+
+type TabOrder struct {
+	ID      string             `json:"id"`
+	OrderId string             `json:"order_id"`
+	Status  models.OrderStatus `json:"status"`
+	Total   uint               `json:"total"`
+}
+
+// TabLine is one food of the tab with the quantities of every order that has
+// it at that price added up.
+type TabLine struct {
+	FoodID   string `json:"food_id"`
+	NameUz   string `json:"name_uz"`
+	NameRu   string `json:"name_ru"`
+	NameEn   string `json:"name_en"`
+	Price    uint   `json:"price"`
+	Quantity uint   `json:"quantity"`
+	Amount   uint   `json:"amount"`
+}
+
+type TabResponse struct {
+	TableID        string            `json:"table_id"`
+	TableSessionID string            `json:"table_session_id"`
+	OpenedAt       time.Time         `json:"opened_at"`
+	ClosedAt       *time.Time        `json:"closed_at"`
+	Orders         []TabOrder        `json:"orders"`
+	Lines          []TabLine         `json:"lines"`
+	Price          pricing.Breakdown `json:"price"`
+	Paid           uint              `json:"paid"`
+	Outstanding    uint              `json:"outstanding"`
+}
+
+// NewTab expects the orders of the session with their lines; paid is what
+// confirmed payments cover of them.
+func NewTab(session models.TableSession, orders []models.Order, paid uint) TabResponse {
+	res := TabResponse{
+		TableID:        session.TableID,
+		TableSessionID: session.ID,
+		OpenedAt:       session.CreatedAt,
+		ClosedAt:       session.ClosedAt,
+		Orders:         make([]TabOrder, 0, len(orders)),
+		Lines:          []TabLine{},
+		Paid:           paid,
+	}
+	type lineKey struct {
+		foodID string
+		price  uint
+	}
+	lines := map[lineKey]int{}
+	breakdowns := make([]pricing.Breakdown, 0, len(orders))
+	for _, o := range orders {
+		res.Orders = append(res.Orders, TabOrder{ID: o.ID, OrderId: o.OrderId, Status: o.Status, Total: o.Total})
+		breakdowns = append(breakdowns, o.Breakdown)
+		for _, f := range o.OrderFood {
+			key := lineKey{f.FoodID, f.Price}
+			i, seen := lines[key]
+			if !seen {
+				i = len(res.Lines)
+				lines[key] = i
+				res.Lines = append(res.Lines, TabLine{FoodID: f.FoodID, NameUz: f.NameUz, NameRu: f.NameRu, NameEn: f.NameEn, Price: f.Price})
+			}
+			res.Lines[i].Quantity += f.Quantity
+			// The order was priced with this line, so it is within range.
+			amount, _ := pricing.Line{Price: f.Price, Quantity: f.Quantity}.Amount()
+			res.Lines[i].Amount += amount
+		}
+	}
+	res.Price = pricing.Sum(breakdowns...)
+	if paid < res.Price.Total {
+		res.Outstanding = res.Price.Total - paid
+	}
+	return res
+}
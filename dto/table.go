@@ -0,0 +1,39 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type TableInput struct {
+	Number uint `json:"number" validate:"required"`
+}
+
+func (in TableInput) Apply(t *models.Table) {
+	t.Number = in.Number
+}
+
+type TableResponse struct {
+	ID        string    `json:"id"`
+	Number    uint      `json:"number"`
+	CreatedAt time.Time `json:"created"`
+	UpdatedAt time.Time `json:"updated"`
+}
+
+func NewTable(t models.Table) TableResponse {
+	return TableResponse{
+		ID:        t.ID,
+		Number:    t.Number,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+}
+
+func NewTableList(tables []models.Table) []TableResponse {
+	res := make([]TableResponse, 0, len(tables))
+	for _, t := range tables {
+		res = append(res, NewTable(t))
+	}
+	return res
+}
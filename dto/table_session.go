@@ -0,0 +1,53 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type OpenTableSessionInput struct {
+	Key string `json:"key" validate:"required"`
+}
+
+type TableSessionResponse struct {
+	ID         string         `json:"id"`
+	TableID    string         `json:"table_id"`
+	Table      *TableResponse `json:"table,omitempty"`
+	LastSeenAt time.Time      `json:"last_seen_at"`
+	ClosedAt   *time.Time     `json:"closed_at"`
+	ClosedByID *string        `json:"closed_by_id"`
+	CreatedAt  time.Time      `json:"created"`
+}
+
+func NewTableSession(s models.TableSession) TableSessionResponse {
+	res := TableSessionResponse{
+		ID:         s.ID,
+		TableID:    s.TableID,
+		LastSeenAt: s.LastSeenAt,
+		ClosedAt:   s.ClosedAt,
+		ClosedByID: s.ClosedByID,
+		CreatedAt:  s.CreatedAt,
+	}
+	if s.Table.ID != "" {
+		table := NewTable(s.Table)
+		res.Table = &table
+	}
+	return res
+}
+
+func NewTableSessionList(sessions []models.TableSession) []TableSessionResponse {
+	res := make([]TableSessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, NewTableSession(s))
+	}
+	return res
+}
+
+// TableSessionTokenResponse is sent to the guest's browser, which passes the
+// token in the X-Table-Token header.
+type TableSessionTokenResponse struct {
+	Token     string               `json:"token"`
+	ExpiresIn int64                `json:"expires_in"`
+	Session   TableSessionResponse `json:"session"`
+}
@@ -0,0 +1,165 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+)
+
+type LoginInput struct {
+	Login    string `json:"login" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type LoginResponse struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	TokenResponse
+}
+
+type CreateStaffInput struct {
+	Login       string  `json:"login" validate:"required"`
+	Password    string  `json:"password" validate:"required"`
+	RoleID      *string `json:"role_id"`
+	DisplayName string  `json:"display_name"`
+	Phone       string  `json:"phone" validate:"omitempty,e164"`
+	Pin         string  `json:"pin" validate:"omitempty,pin"`
+}
+
+func (in CreateStaffInput) Model() models.User {
+	return models.User{Login: in.Login, RoleID: in.RoleID, DisplayName: in.DisplayName, Phone: in.Phone}
+}
+
+// UpdateStaffInput leaves the password and PIN untouched when they are empty
+// and the role untouched when role_id is omitted.
+type UpdateStaffInput struct {
+	Login       string  `json:"login" validate:"required"`
+	Password    string  `json:"password"`
+	RoleID      *string `json:"role_id"`
+	DisplayName string  `json:"display_name"`
+	Phone       string  `json:"phone" validate:"omitempty,e164"`
+	Pin         string  `json:"pin" validate:"omitempty,pin"`
+}
+
+func (in UpdateStaffInput) Apply(u *models.User) {
+	u.Login = in.Login
+	u.DisplayName = in.DisplayName
+	u.Phone = in.Phone
+	if in.RoleID != nil {
+		u.RoleID = in.RoleID
+		u.Role = nil
+	}
+}
+
+type ChangePasswordInput struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,nefield=OldPassword"`
+}
+
+type DeactivateStaffInput struct {
+	ReassignTo *string `json:"reassign_to"`
+}
+
+type StaffResponse struct {
+	ID          string        `json:"id"`
+	Login       string        `json:"login"`
+	DisplayName string        `json:"display_name"`
+	Phone       string        `json:"phone"`
+	HasPin      bool          `json:"has_pin"`
+	RoleID      *string       `json:"role_id"`
+	Role        *RoleResponse `json:"role,omitempty"`
+	Active      bool          `json:"active"`
+	CreatedAt   time.Time     `json:"created"`
+	UpdatedAt   time.Time     `json:"updated"`
+}
+
+func NewStaff(u models.User) StaffResponse {
+	res := StaffResponse{
+		ID:          u.ID,
+		Login:       u.Login,
+		DisplayName: u.DisplayName,
+		Phone:       u.Phone,
+		HasPin:      u.PinHash != "",
+		RoleID:      u.RoleID,
+		Active:      u.Active,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+	}
+	if u.Role != nil {
+		role := NewRole(*u.Role)
+		res.Role = &role
+	}
+	return res
+}
+
+func NewStaffList(users []models.User) []StaffResponse {
+	res := make([]StaffResponse, 0, len(users))
+	for _, u := range users {
+		res = append(res, NewStaff(u))
+	}
+	return res
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	DeviceID   *string   `json:"device_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created"`
+}
+
+func NewSessionList(sessions []models.Session) []SessionResponse {
+	res := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, SessionResponse{
+			ID:         s.ID,
+			DeviceID:   s.DeviceID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			ExpiresAt:  s.ExpiresAt,
+			LastUsedAt: s.LastUsedAt,
+			CreatedAt:  s.CreatedAt,
+		})
+	}
+	return res
+}
+
+type LoginEventResponse struct {
+	ID        string    `json:"id"`
+	Login     string    `json:"login"`
+	UserID    *string   `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created"`
+}
+
+func NewLoginEventList(events []models.LoginEvent) []LoginEventResponse {
+	res := make([]LoginEventResponse, 0, len(events))
+	for _, e := range events {
+		res = append(res, LoginEventResponse{
+			ID:        e.ID,
+			Login:     e.Login,
+			UserID:    e.UserID,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			Success:   e.Success,
+			Reason:    e.Reason,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return res
+}
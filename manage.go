@@ -1,69 +1,570 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 
 	"github.com/davronkhamdamov/restaraunt_backend/middleware"
 	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/payments"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
 	"github.com/davronkhamdamov/restaraunt_backend/views"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
-func main() {
-	runserver()
+type route struct {
+	Path       string
+	Method     string
+	Handler    http.HandlerFunc
+	Permission string
 }
 
-func runserver() {
-	router := mux.NewRouter()
-	models.ConnectDB()
-	models.MigrateDB()
+const (
+	public        = ""
+	authenticated = "authenticated"
+	device        = "device"
+	guest         = "guest"
+)
 
+// routes is the single place that decides who may call which handler.
+// A public route needs no token, a device route needs the token of a
+// registered tablet, a guest route needs the token of an open table session,
+// an authenticated route needs any valid user token, and every other route
+// also needs a user whose current role grants the listed permission.
+var routes = []route{
 	// Auth
-	router.HandleFunc("/v1/login", views.Login).Methods("POST")
+	{"/v1/login", "POST", views.Login, public},
+	{"/v1/auth/refresh", "POST", views.RefreshToken, public},
+	{"/v1/auth/logout", "POST", views.Logout, authenticated},
+	{"/v1/auth/pin", "POST", views.PinLogin, device},
+	// Current user
+	{"/v1/me", "GET", views.GetMe, authenticated},
+	{"/v1/me/password", "PUT", views.ChangeMyPassword, authenticated},
+	// Devices
+	{"/v1/device", "POST", views.CreateDevice, models.PermDeviceManage},
+	{"/v1/device", "GET", views.GetDevices, models.PermDeviceManage},
+	{"/v1/device/{id}", "DELETE", views.RevokeDevice, models.PermDeviceManage},
+	{"/v1/device/staff", "GET", views.GetDeviceStaff, device},
 	// Users
-	router.Handle("/v1/staff", middleware.AuthMiddleware(http.HandlerFunc(views.CreateStaff))).Methods("POST")
-	router.Handle("/v1/staff", middleware.AuthMiddleware(http.HandlerFunc(views.GetStaffs))).Methods("GET")
-	router.Handle("/v1/staff/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.GetStaff))).Methods("GET")
-	router.Handle("/v1/staff/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.UpdateStaff))).Methods("PUT")
+	{"/v1/staff", "POST", views.CreateStaff, models.PermStaffManage},
+	{"/v1/staff", "GET", views.GetStaffs, models.PermStaffManage},
+	{"/v1/staff/{id}", "GET", views.GetStaff, models.PermStaffManage},
+	{"/v1/staff/{id}", "PUT", views.UpdateStaff, models.PermStaffManage},
+	{"/v1/staff/{id}", "DELETE", views.DeleteStaff, models.PermStaffManage},
+	{"/v1/staff/{id}/deactivate", "POST", views.DeactivateStaff, models.PermStaffManage},
+	{"/v1/staff/{id}/activate", "POST", views.ActivateStaff, models.PermStaffManage},
+	{"/v1/staff/{id}/unlock", "POST", views.UnlockStaff, models.PermStaffManage},
+	{"/v1/login-events", "GET", views.GetLoginEvents, models.PermStaffManage},
+	{"/v1/staff/{id}/sessions", "GET", views.GetStaffSessions, models.PermStaffManage},
+	{"/v1/staff/{id}/sessions", "DELETE", views.RevokeStaffSessions, models.PermStaffManage},
+	{"/v1/staff/{id}/sessions/{session_id}", "DELETE", views.RevokeStaffSession, models.PermStaffManage},
+	// Roles
+	{"/v1/permission", "GET", views.GetPermissions, models.PermStaffManage},
+	{"/v1/role", "POST", views.CreateRole, models.PermStaffManage},
+	{"/v1/role", "GET", views.GetRoles, models.PermStaffManage},
+	{"/v1/role/{id}", "GET", views.GetRole, models.PermStaffManage},
+	{"/v1/role/{id}", "PUT", views.UpdateRole, models.PermStaffManage},
+	{"/v1/role/{id}", "DELETE", views.DeleteRole, models.PermStaffManage},
 	// Tables
-	router.HandleFunc("/v1/table/{id}", views.GetTable).Methods("GET")
-	router.HandleFunc("/v1/table/one/{id}", views.GetOneTable).Methods("GET")
-	router.Handle("/v1/table", middleware.AuthMiddleware(http.HandlerFunc(views.CreateTable))).Methods("POST")
-	router.Handle("/v1/table", middleware.AuthMiddleware(http.HandlerFunc(views.GetTables))).Methods("GET")
-	router.Handle("/v1/table/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.UpdateTable))).Methods("PUT")
-	router.Handle("/v1/table/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.DeleteTable))).Methods("DELETE")
+	{"/v1/table/{id}", "GET", views.GetTable, models.PermTablesView},
+	{"/v1/table/one/{id}", "GET", views.GetOneTable, public},
+	{"/v1/table", "POST", views.CreateTable, models.PermTablesManage},
+	{"/v1/table", "GET", views.GetTables, models.PermTablesView},
+	{"/v1/table/{id}", "PUT", views.UpdateTable, models.PermTablesManage},
+	{"/v1/table/{id}", "DELETE", views.DeleteTable, models.PermTablesManage},
+	{"/v1/table/{id}/session", "POST", views.OpenTableSession, public},
+	{"/v1/table/{id}/session", "DELETE", views.CloseTableSession, models.PermTablesClose},
+	{"/v1/table-session", "GET", views.GetTableSessions, models.PermTablesView},
+	{"/v1/table/{id}/tab", "GET", views.GetTableTab, models.PermOrdersView},
+	{"/v1/table/{id}/tab/close", "POST", views.CloseTab, models.PermOrdersPay},
+	{"/v1/tab", "GET", views.GetMyTab, guest},
 	// Food
-	router.HandleFunc("/v1/food/{id}", views.GetFood).Methods("GET")
-	router.HandleFunc("/v1/food-with-category", views.GetCategoriesAndFoods).Methods("GET")
-	router.HandleFunc("/v1/food", views.GetAllFood).Methods("GET")
-	router.Handle("/v1/food", middleware.AuthMiddleware(http.HandlerFunc(views.CreateFood))).Methods("POST")
-	router.Handle("/v1/food/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.UpdateFood))).Methods("PUT")
-	router.Handle("/v1/food/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.DeleteFood))).Methods("DELETE")
+	{"/v1/food/{id}", "GET", views.GetFood, public},
+	{"/v1/food-with-category", "GET", views.GetCategoriesAndFoods, public},
+	{"/v1/food", "GET", views.GetAllFood, public},
+	{"/v1/food", "POST", views.CreateFood, models.PermMenuEdit},
+	{"/v1/food/{id}", "PUT", views.UpdateFood, models.PermMenuEdit},
+	{"/v1/food/{id}", "DELETE", views.DeleteFood, models.PermMenuEdit},
+	{"/v1/food/{id}/note-presets", "GET", views.GetNotePresets, public},
+	{"/v1/food/{id}/note-presets", "POST", views.CreateNotePreset, models.PermMenuEdit},
+	{"/v1/note-preset/{id}", "PUT", views.UpdateNotePreset, models.PermMenuEdit},
+	{"/v1/note-preset/{id}", "DELETE", views.DeleteNotePreset, models.PermMenuEdit},
 	// Category
-	router.HandleFunc("/v1/category/{id}", views.GetCategory).Methods("GET")
-	router.HandleFunc("/v1/category", views.GetAllCategory).Methods("GET")
-	router.Handle("/v1/category", middleware.AuthMiddleware(http.HandlerFunc(views.CreateCategory))).Methods("POST")
-	router.Handle("/v1/category/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.UpdateCategory))).Methods("PUT")
-	router.Handle("/v1/category/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.DeleteCategory))).Methods("DELETE")
+	{"/v1/category/{id}", "GET", views.GetCategory, public},
+	{"/v1/category", "GET", views.GetAllCategory, public},
+	{"/v1/category", "POST", views.CreateCategory, models.PermMenuEdit},
+	{"/v1/category/{id}", "PUT", views.UpdateCategory, models.PermMenuEdit},
+	{"/v1/category/{id}", "DELETE", views.DeleteCategory, models.PermMenuEdit},
 	// Order
-	router.HandleFunc("/ws", views.Orders)
-	router.HandleFunc("/v1/order", views.NewOrder).Methods("POST")
-	router.HandleFunc("/v1/order/xlsx", views.DownloadOrderExcel).Methods("GET")
-	router.HandleFunc("/v1/order/{id}", views.GetOrder).Methods("GET")
-	router.HandleFunc("/v1/order", views.GetOrders).Methods("GET")
-	router.Handle("/v1/order_staff", middleware.AuthMiddleware(http.HandlerFunc(views.GetOrdersForStaff))).Methods("GET")
-	router.Handle("/v1/order/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.UpdateOrderStatus))).Methods("PUT")
-	router.Handle("/v1/order/receive/{id}", middleware.AuthMiddleware(http.HandlerFunc(views.ReceiveOrder))).Methods("PUT")
-	router.Handle("/v1/orders", middleware.AuthMiddleware(http.HandlerFunc(views.DeleteAllOrders))).Methods("DELETE")
+	{"/v1/ws/ticket", "POST", views.IssueWebSocketTicket, public},
+	{"/ws", "", views.Orders, public},
+	{"/v1/order", "POST", views.NewOrder, guest},
+	{"/v1/order/xlsx", "GET", views.DownloadOrderExcel, models.PermOrdersView},
+	{"/v1/order/{id}", "GET", views.GetOrder, public},
+	// Staff and guests; GetOrderByNumber checks the credentials itself.
+	{"/v1/order/number/{number}", "GET", views.GetOrderByNumber, public},
+	{"/v1/order", "GET", views.GetOrders, models.PermOrdersView},
+	{"/v1/order_staff", "GET", views.GetOrdersForStaff, models.PermOrdersView},
+	// The permission for each status change comes from models.OrderTransitions.
+	{"/v1/order/{id}", "PUT", views.UpdateOrderStatus, authenticated},
+	{"/v1/order/{id}/history", "GET", views.GetOrderHistory, models.PermOrdersView},
+	{"/v1/order/{id}/cancel", "POST", views.CancelOrderByGuest, guest},
+	{"/v1/order/{id}/items", "POST", views.AddOrderItem, guest},
+	{"/v1/order/{id}/items/{item_id}", "PUT", views.UpdateOrderItem, guest},
+	{"/v1/order/{id}/items/{item_id}", "DELETE", views.RemoveOrderItem, guest},
+	{"/v1/order/{id}/note", "PUT", views.UpdateOrderNote, models.PermOrdersUpdate},
+	{"/v1/order/{id}/items/{item_id}/note", "PUT", views.UpdateOrderItemNote, models.PermOrdersUpdate},
+	{"/v1/order/{id}/items/{item_id}/status", "PUT", views.UpdateDishStatus, models.PermKitchenCook},
+	{"/v1/order/receive/{id}", "PUT", views.ReceiveOrder, models.PermOrdersClaim},
+	{"/v1/orders", "DELETE", views.DeleteAllOrders, models.PermOrdersDelete},
+	// Payments
+	{"/v1/order/{id}/payments", "GET", views.GetOrderPayments, models.PermOrdersView},
+	{"/v1/order/{id}/payments", "POST", views.InitiatePayment, models.PermOrdersPay},
+	{"/v1/payment/{id}/confirm", "POST", views.ConfirmPayment, models.PermOrdersPay},
+	{"/v1/payment/{id}/cancel", "POST", views.CancelPayment, models.PermOrdersPay},
+	{"/v1/bill-split", "POST", views.CreateBillSplit, models.PermOrdersPay},
+	{"/v1/bill-split/{id}", "GET", views.GetBillSplit, models.PermOrdersView},
+	{"/v1/bill-split/{id}", "DELETE", views.CancelBillSplit, models.PermOrdersPay},
+	{"/v1/bill/{id}/payments", "POST", views.InitiateBillPayment, models.PermOrdersPay},
+	// Signed by the provider; see payments.Provider.Callback.
+	{"/v1/payment/callback/{provider}", "POST", views.PaymentCallback, public},
 	// Feedback
-	router.HandleFunc("/v1/feedback", views.GetAllFeedback).Methods("GET")
-	router.HandleFunc("/v1/feedback/xlsx", views.DownloadFeedbackExcel).Methods("GET")
-	router.HandleFunc("/v1/feedback", views.CreateFeedback).Methods("POST")
+	{"/v1/feedback", "GET", views.GetAllFeedback, models.PermReportsView},
+	{"/v1/feedback/xlsx", "GET", views.DownloadFeedbackExcel, models.PermReportsView},
+	{"/v1/feedback", "POST", views.CreateFeedback, guest},
 	// Dashboard
-	router.Handle("/v1/dashboard", middleware.AuthMiddleware(http.HandlerFunc(views.GetDashboard))).Methods("GET")
-	router.HandleFunc("/v1/common_food", views.GetMostCommonFood).Methods("GET")
+	{"/v1/dashboard", "GET", views.GetDashboard, models.PermReportsView},
+	{"/v1/common_food", "GET", views.GetMostCommonFood, public},
+	{"/v1/report/cancellations", "GET", views.GetCancellationReport, models.PermReportsView},
+	{"/v1/report/cancellations/xlsx", "GET", views.DownloadCancellationExcel, models.PermReportsView},
+	// Audit
+	{"/v1/audit", "GET", views.GetAuditLogs, models.PermAuditView},
+	{"/v1/audit/xlsx", "GET", views.DownloadAuditExcel, models.PermAuditView},
+}
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+type command struct {
+	Name  string
+	Usage string
+	Run   func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"runserver", "runserver [-addr host:port]", runserver},
+		{"migrate", "migrate", migrate},
+		{"createadmin", "createadmin -login <login> [-password <password>]", createadmin},
+		{"resetpassword", "resetpassword [-password <password>] <login>", resetpassword},
+		{"seed-demo", "seed-demo [-tables n]", seedDemo},
+		{"check-config", "check-config [-db=false]", checkConfig},
+		{"fakepay", "fakepay [-addr host:port]", fakepay},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: manage <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  "+c.Usage)
+	}
+}
+
+// main runs the server when no command is given, which is how the systemd
+// unit starts the binary.
+func main() {
+	if len(os.Args) < 2 {
+		os.Exit(runserver(nil))
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		os.Exit(exitOK)
+	}
+	for _, c := range commands {
+		if c.Name == name {
+			os.Exit(c.Run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.Name == name {
+				fmt.Fprintln(fs.Output(), "Usage: manage "+c.Usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func fail(format string, args ...any) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return exitError
+}
+
+func connect(migrateFirst bool) error {
+	if err := models.ConnectDB(); err != nil {
+		return err
+	}
+	if migrateFirst {
+		return models.MigrateDB()
+	}
+	return nil
+}
+
+func runserver(args []string) int {
+	fs := newFlagSet("runserver")
+	addr := fs.String("addr", "0.0.0.0:8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := connect(true); err != nil {
+		return fail("%v", err)
+	}
+	if err := utils.InitTokens(); err != nil {
+		return fail("Invalid token configuration: %v", err)
+	}
+	if err := utils.InitTrustedProxies(); err != nil {
+		return fail("Invalid proxy configuration: %v", err)
+	}
+	if err := views.InitLoginProtection(); err != nil {
+		return fail("Invalid login protection configuration: %v", err)
+	}
+	if err := utils.InitPasswordPolicy(); err != nil {
+		return fail("Invalid password policy: %v", err)
+	}
+	if err := middleware.InitTableSessions(); err != nil {
+		return fail("Invalid table session configuration: %v", err)
+	}
+	if err := views.InitOrders(); err != nil {
+		return fail("Invalid order configuration: %v", err)
+	}
+	if err := views.InitWebSocket(); err != nil {
+		return fail("Invalid WebSocket configuration: %v", err)
+	}
+	if err := pricing.Init(); err != nil {
+		return fail("Invalid pricing configuration: %v", err)
+	}
+	if err := payments.Init(); err != nil {
+		return fail("Invalid payment configuration: %v", err)
+	}
+
+	go views.SweepWebSockets()
+
+	router := mux.NewRouter()
+	for _, rt := range routes {
+		var handler http.Handler = rt.Handler
+		switch rt.Permission {
+		case public:
+		case device:
+			handler = middleware.DeviceMiddleware(handler)
+		case guest:
+			handler = middleware.TableSessionMiddleware(handler)
+		case authenticated:
+			handler = middleware.AuthMiddleware(handler)
+		default:
+			handler = middleware.AuthMiddleware(middleware.RequirePermission(rt.Permission)(handler))
+		}
+		r := router.Handle(rt.Path, handler)
+		if rt.Method != "" {
+			r.Methods(rt.Method)
+		}
+	}
+
+	fmt.Printf("Starting Server http://%s/\n", *addr)
+	if err := http.ListenAndServe(*addr, middleware.CorsMiddleware(router)); err != nil {
+		return fail("%v", err)
+	}
+	return exitOK
+}
+
+func migrate(args []string) int {
+	fs := newFlagSet("migrate")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := connect(true); err != nil {
+		return fail("%v", err)
+	}
+	return exitOK
+}
+
+// readPassword takes the password from the flag or, when it is empty, from
+// the first line of stdin so it does not end up in the shell history.
+func readPassword(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
+
+func checkPassword(password, login string) error {
+	policy, err := utils.NewPasswordPolicyFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid password policy: %w", err)
+	}
+	return policy.Check(password, login)
+}
+
+func createadmin(args []string) int {
+	fs := newFlagSet("createadmin")
+	login := fs.String("login", "", "login of the new admin")
+	password := fs.String("password", "", "password, read from stdin when omitted")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *login == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := connect(false); err != nil {
+		return fail("%v", err)
+	}
+	var adminRole models.Role
+	if err := models.DB.Where("name = ?", models.AdminRoleName).First(&adminRole).Error; err != nil {
+		return fail("Admin role not found, run \"manage migrate\" first: %v", err)
+	}
+	plain, err := readPassword(*password)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if err := checkPassword(plain, *login); err != nil {
+		return fail("%v", err)
+	}
+	hashed, err := utils.HashPassword(plain)
+	if err != nil {
+		return fail("%v", err)
+	}
+	user := models.User{Login: *login, Password: hashed, RoleID: &adminRole.ID}
+	if err := models.DB.Create(&user).Error; err != nil {
+		return fail("Failed to create admin: %v", err)
+	}
+	fmt.Printf("Admin %q created\n", user.Login)
+	return exitOK
+}
+
+func resetpassword(args []string) int {
+	fs := newFlagSet("resetpassword")
+	password := fs.String("password", "", "new password, read from stdin when omitted")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	login := fs.Arg(0)
+	if err := connect(false); err != nil {
+		return fail("%v", err)
+	}
+	var user models.User
+	if err := models.DB.Where("login = ?", login).First(&user).Error; err != nil {
+		return fail("User %q not found", login)
+	}
+	plain, err := readPassword(*password)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if err := checkPassword(plain, user.Login); err != nil {
+		return fail("%v", err)
+	}
+	hashed, err := utils.HashPassword(plain)
+	if err != nil {
+		return fail("%v", err)
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashed).Error; err != nil {
+			return err
+		}
+		return models.RevokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		return fail("Failed to reset password: %v", err)
+	}
+	fmt.Printf("Password of %q changed, all sessions revoked\n", user.Login)
+	return exitOK
+}
+
+type demoFood struct {
+	NameUz, NameRu, NameEn                      string
+	DescriptionUz, DescriptionRu, DescriptionEn string
+	Price                                       uint
+	Weight                                      float32
+	WeightType                                  string
+}
+
+var demoMenu = []struct {
+	NameUz, NameRu, NameEn string
+	Foods                  []demoFood
+}{
+	{"Salatlar", "Салаты", "Salads", []demoFood{
+		{"Achchiq-chuchuk", "Ачичук", "Achichuk", "Pomidor, bodring va piyozli salat", "Салат из помидоров, огурцов и лука", "Tomato, cucumber and onion salad", 18000, 250, "g"},
+	}},
+	{"Sho'rvalar", "Супы", "Soups", []demoFood{
+		{"Mastava", "Мастава", "Mastava", "Go'shtli guruch sho'rva", "Рисовый суп с говядиной", "Rice soup with beef", 28000, 400, "ml"},
+	}},
+	{"Asosiy taomlar", "Основные блюда", "Main dishes", []demoFood{
+		{"Osh", "Плов", "Plov", "Mol go'shti, sabzi va guruch", "Говядина, морковь и рис", "Beef, carrots and rice", 45000, 350, "g"},
+		{"Lag'mon", "Лагман", "Lagman", "Go'sht va sabzavotli qo'l lag'mon", "Лапша ручной работы с мясом и овощами", "Hand-pulled noodles with beef and vegetables", 38000, 400, "g"},
+	}},
+	{"Ichimliklar", "Напитки", "Drinks", []demoFood{
+		{"Ko'k choy", "Зелёный чай", "Green tea", "Bir choynak ko'k choy", "Чайник зелёного чая", "A pot of green tea", 8000, 1, "l"},
+	}},
+}
+
+func seedDemo(args []string) int {
+	fs := newFlagSet("seed-demo")
+	tables := fs.Uint("tables", 10, "number of tables to create")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := connect(true); err != nil {
+		return fail("%v", err)
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		for _, c := range demoMenu {
+			category := models.Category{}
+			if err := tx.Where(models.Category{NameEn: c.NameEn}).
+				Attrs(models.Category{NameUz: c.NameUz, NameRu: c.NameRu}).
+				FirstOrCreate(&category).Error; err != nil {
+				return err
+			}
+			for _, f := range c.Foods {
+				food := models.Food{}
+				err := tx.Where(models.Food{NameEn: f.NameEn, CategoryID: category.ID}).
+					Attrs(models.Food{
+						NameUz:        f.NameUz,
+						NameRu:        f.NameRu,
+						DescriptionUz: f.DescriptionUz,
+						DescriptionRu: f.DescriptionRu,
+						DescriptionEn: f.DescriptionEn,
+						Price:         f.Price,
+						ImageUrl:      "https://placehold.co/400x300?text=" + url.QueryEscape(f.NameEn),
+						Weight:        f.Weight,
+						WeightType:    f.WeightType,
+						Available:     true,
+					}).
+					FirstOrCreate(&food).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for n := uint(1); n <= *tables; n++ {
+			if err := tx.Where(models.Table{Number: n}).FirstOrCreate(&models.Table{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fail("Failed to seed demo data: %v", err)
+	}
+	fmt.Println("Demo data created")
+	return exitOK
+}
+
+// fakepay serves the wallet stand-in that PAYMENT_FAKE_URL points to, so
+// Click and Payme payments can be tried without the real providers.
+func fakepay(args []string) int {
+	fs := newFlagSet("fakepay")
+	addr := fs.String("addr", "127.0.0.1:8090", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	utils.LoadEnv()
+	secret := utils.GetEnv("PAYMENT_FAKE_SECRET")
+	if secret == "" {
+		return fail("PAYMENT_FAKE_SECRET is not set")
+	}
+	publicURL := cmp.Or(utils.GetEnv("PAYMENT_FAKE_URL"), "http://"+*addr)
+	fmt.Printf("Fake payment provider listening on http://%s/\n", *addr)
+	if err := http.ListenAndServe(*addr, payments.NewFakeServer(publicURL, secret)); err != nil {
+		return fail("%v", err)
+	}
+	return exitOK
+}
 
-	fmt.Println("Starting Server http://localhost:8080/")
-	http.ListenAndServe("0.0.0.0:8080", middleware.CorsMiddleware(router))
+func checkConfig(args []string) int {
+	fs := newFlagSet("check-config")
+	checkDB := fs.Bool("db", true, "also try to connect to the database")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	utils.LoadEnv()
+	failed := false
+	report := func(name string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			return
+		}
+		fmt.Printf("ok   %s\n", name)
+	}
+	for _, key := range []string{"DB_HOST", "DB_USER", "DB_NAME", "DB_PORT", "DB_TIMEZONE"} {
+		var err error
+		if utils.GetEnv(key) == "" {
+			err = errors.New("not set")
+		}
+		report(key, err)
+	}
+	_, err := utils.NewTokenServiceFromEnv()
+	report("tokens", err)
+	report("trusted proxies", utils.InitTrustedProxies())
+	report("login protection", views.InitLoginProtection())
+	_, err = utils.NewPasswordPolicyFromEnv()
+	report("password policy", err)
+	_, err = utils.NewTicketStoreFromEnv()
+	report("websocket tickets", err)
+	report("table sessions", middleware.InitTableSessions())
+	report("orders", views.InitOrders())
+	_, err = pricing.NewSettingsFromEnv()
+	report("pricing", err)
+	report("payments", payments.Init())
+	if *checkDB {
+		err := models.ConnectDB()
+		if err == nil {
+			var sqlDB *sql.DB
+			if sqlDB, err = models.DB.DB(); err == nil {
+				err = sqlDB.Ping()
+			}
+		}
+		report("database", err)
+	}
+	if failed {
+		return exitError
+	}
+	return exitOK
 }
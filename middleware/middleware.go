@@ -1,31 +1,103 @@
 package middleware
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/davronkhamdamov/restaraunt_backend/models"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-const your_secret_key string = "your_secret_key"
+type contextKey string
 
-type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
+const (
+	UserIDKey    = contextKey("user_id")
+	SessionIDKey = contextKey("session_id")
+	RoleKey      = contextKey("role")
+	DeviceIDKey  = contextKey("device_id")
 
-type contextKey string
+	TableIDKey        = contextKey("table_id")
+	TableSessionIDKey = contextKey("table_session_id")
+)
+
+type permissionsKey struct{}
+
+var (
+	ErrSessionRevoked = errors.New("session is revoked or expired")
+	ErrUserInactive   = errors.New("user is deactivated")
+	ErrUnknownDevice  = errors.New("device is unknown or revoked")
+	ErrDeviceMismatch = errors.New("token belongs to another device")
+	ErrTableClosed    = errors.New("table session is closed or idle")
+)
 
 const (
-	UserIDKey = contextKey("user_id")
-	RoleKey   = contextKey("role")
+	DeviceTokenHeader = "X-Device-Token"
+	TableTokenHeader  = "X-Table-Token"
 )
 
+// TableSessionIdle is how long a guest table session stays usable without
+// requests. InitTableSessions reads it from TABLE_SESSION_IDLE.
+var TableSessionIdle = 2 * time.Hour
+
+func InitTableSessions() error {
+	idle, err := time.ParseDuration(cmp.Or(utils.GetEnv("TABLE_SESSION_IDLE"), "2h"))
+	if err != nil {
+		return fmt.Errorf("TABLE_SESSION_IDLE: %w", err)
+	}
+	TableSessionIdle = idle
+	return nil
+}
+
+func FindDevice(deviceToken string) (*models.Device, error) {
+	if deviceToken == "" {
+		return nil, ErrUnknownDevice
+	}
+	device := models.Device{}
+	if dbResult := models.DB.Where("token_hash = ? AND active", utils.HashToken(deviceToken)).First(&device); dbResult.Error != nil {
+		return nil, ErrUnknownDevice
+	}
+	return &device, nil
+}
+
+// Authenticate verifies an access token and loads its user and session. The
+// role always comes from the database so that a demoted user loses access on
+// the next request, not when the token expires. Sessions opened with a PIN
+// also need the token of their device.
+func Authenticate(tokenString, deviceToken string) (*models.User, *models.Session, error) {
+	claims, err := utils.Tokens.Parse(tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+	session := models.Session{}
+	if dbResult := models.DB.Where("ID = ? AND user_id = ?", claims.SessionID, claims.UserID).First(&session); dbResult.Error != nil {
+		return nil, nil, ErrSessionRevoked
+	}
+	if !session.Active(time.Now()) {
+		return nil, nil, ErrSessionRevoked
+	}
+	if session.DeviceID != nil {
+		device, err := FindDevice(deviceToken)
+		if err != nil {
+			return nil, nil, err
+		}
+		if device.ID != *session.DeviceID {
+			return nil, nil, ErrDeviceMismatch
+		}
+	}
+	user := models.User{}
+	if dbResult := models.DB.Preload("Role.Permissions").Where("ID = ?", claims.UserID).First(&user); dbResult.Error != nil {
+		return nil, nil, fmt.Errorf("user not found: %w", dbResult.Error)
+	}
+	if !user.Active {
+		return nil, nil, ErrUserInactive
+	}
+	return &user, &session, nil
+}
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("Authorization")
@@ -33,36 +105,66 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header is missing", nil)
 			return
 		}
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(your_secret_key), nil
-		})
-
-		if err != nil || !token.Valid {
+		user, session, err := Authenticate(tokenString, r.Header.Get(DeviceTokenHeader))
+		if err != nil {
 			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid token", err.Error())
 			return
 		}
-		user := models.User{}
-		if dbResult := models.DB.Where("ID = ?", claims.UserID).First(&user); dbResult.Error != nil {
-			utils.RespondWithError(w, http.StatusNotFound, "User not found", dbResult.Error)
+		roleName := ""
+		permissions := map[string]bool{}
+		if user.Role != nil {
+			roleName = user.Role.Name
+			for _, p := range user.Role.Permissions {
+				permissions[p.Code] = true
+			}
+		}
+		ctx := context.WithValue(r.Context(), UserIDKey, user.ID)
+		ctx = context.WithValue(ctx, SessionIDKey, session.ID)
+		ctx = context.WithValue(ctx, RoleKey, roleName)
+		ctx = context.WithValue(ctx, permissionsKey{}, permissions)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// DeviceMiddleware lets a registered tablet call device-only endpoints such
+// as the PIN switch.
+func DeviceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		device, err := FindDevice(r.Header.Get(DeviceTokenHeader))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid device token", err.Error())
 			return
 		}
-		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, RoleKey, claims.Role)
+		models.DB.Model(device).Update("last_seen_at", time.Now())
+		ctx := context.WithValue(r.Context(), DeviceIDKey, device.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequirePermission must be wrapped by AuthMiddleware, which puts the
+// permissions of the user's role into the request context.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(r.Context(), permission) {
+				utils.RespondWithError(w, http.StatusForbidden, "Forbidden", fmt.Sprintf("Permission %q is required", permission))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func HasPermission(ctx context.Context, permission string) bool {
+	permissions, _ := ctx.Value(permissionsKey{}).(map[string]bool)
+	return permissions[permission]
+}
+
 func CorsMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+DeviceTokenHeader+", "+TableTokenHeader+", Idempotency-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -72,3 +174,37 @@ func CorsMiddleware(h http.Handler) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+
+// AuthenticateTable verifies a guest table token and marks its session as
+// used, which restarts the idle timeout.
+func AuthenticateTable(tokenString string) (*models.TableSession, error) {
+	claims, err := utils.Tokens.ParseGuest(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	session := models.TableSession{}
+	if dbResult := models.DB.Where("ID = ? AND table_id = ?", claims.TableSessionID, claims.TableID).First(&session); dbResult.Error != nil {
+		return nil, ErrTableClosed
+	}
+	now := time.Now()
+	if !session.Active(now, TableSessionIdle) {
+		return nil, ErrTableClosed
+	}
+	models.DB.Model(&session).Update("last_seen_at", now)
+	return &session, nil
+}
+
+// TableSessionMiddleware lets guests who scanned the QR code of a table call
+// the endpoints for ordering from that table.
+func TableSessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := AuthenticateTable(r.Header.Get(TableTokenHeader))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid table session", err.Error())
+			return
+		}
+		ctx := context.WithValue(r.Context(), TableIDKey, session.TableID)
+		ctx = context.WithValue(ctx, TableSessionIDKey, session.ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
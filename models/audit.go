@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditLog records one administrative change. Diff maps every changed field
+// to its old and new value: {"price": {"from": 20000, "to": 25000}}.
+type AuditLog struct {
+	ID         string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	ActorID    *string   `gorm:"index" json:"actor_id"`
+	Actor      *User     `gorm:"foreignKey:ActorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"-"`
+	Action     string    `gorm:"not null;index" json:"action"`
+	EntityType string    `gorm:"not null;index:idx_audit_entity" json:"entity_type"`
+	EntityID   string    `gorm:"index:idx_audit_entity" json:"entity_id"`
+	Diff       JSON      `gorm:"type:jsonb" json:"diff"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SplitMode string
+
+const (
+	SplitEqual SplitMode = "equal"
+	SplitItems SplitMode = "items"
+)
+
+// BillSplit divides one order, or the open orders of a table, into bills
+// that are paid separately. While it is active its orders can only be paid
+// through its bills.
+type BillSplit struct {
+	ID          string     `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	TableID     string     `gorm:"not null;index" json:"table_id"`
+	Table       Table      `gorm:"foreignKey:TableID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Mode        SplitMode  `gorm:"not null" json:"mode"`
+	Total       uint       `gorm:"not null" json:"total"`
+	Orders      []Order    `gorm:"many2many:bill_split_orders;constraint:OnDelete:CASCADE" json:"-"`
+	Bills       []Bill     `gorm:"foreignKey:SplitID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"bills"`
+	CreatedByID *string    `json:"created_by_id"`
+	CreatedBy   *User      `gorm:"foreignKey:CreatedByID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"-"`
+	CancelledAt *time.Time `json:"cancelled_at"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created"`
+}
+
+type Bill struct {
+	ID        string     `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	SplitID   string     `gorm:"not null;index" json:"split_id"`
+	Split     *BillSplit `gorm:"foreignKey:SplitID" json:"-"`
+	Label     string     `json:"label"`
+	Subtotal  uint       `gorm:"not null" json:"subtotal"`
+	Amount    uint       `gorm:"not null" json:"amount"`
+	Lines     []BillLine `gorm:"foreignKey:BillID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"lines"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created"`
+}
+
+// BillLine is the share Numerator/Denominator of an order line that a bill
+// pays for. Amount is that share of the line's price times quantity.
+type BillLine struct {
+	ID          string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	BillID      string    `gorm:"not null;index" json:"bill_id"`
+	OrderFoodID string    `gorm:"not null;index" json:"order_food_id"`
+	OrderFood   OrderFood `gorm:"foreignKey:OrderFoodID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Numerator   uint      `gorm:"not null" json:"numerator"`
+	Denominator uint      `gorm:"not null" json:"denominator"`
+	Amount      uint      `gorm:"not null" json:"amount"`
+}
+
+// ActiveSplitOf returns the ID of the split the order is part of, or "".
+func ActiveSplitOf(db *gorm.DB, orderID string) (string, error) {
+	var ids []string
+	err := db.Table("bill_split_orders").
+		Joins("JOIN bill_splits ON bill_splits.id = bill_split_orders.bill_split_id").
+		Where("bill_split_orders.order_id = ? AND bill_splits.cancelled_at IS NULL", orderID).
+		Limit(1).
+		Pluck("bill_splits.id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return "", err
+	}
+	return ids[0], nil
+}
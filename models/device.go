@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Device is a shared tablet registered by an admin. It authenticates with a
+// long random token and lets staff switch to themselves with a PIN.
+type Device struct {
+	ID         string     `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Active     bool       `gorm:"not null;default:true" json:"active"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DishStatus is the kitchen status of one OrderFood line. Lines only move
+// forward: queued → cooking → ready → served.
+type DishStatus string
+
+const (
+	DishQueued  DishStatus = "queued"
+	DishCooking DishStatus = "cooking"
+	DishReady   DishStatus = "ready"
+	DishServed  DishStatus = "served"
+)
+
+var dishSteps = map[DishStatus]int{DishQueued: 0, DishCooking: 1, DishReady: 2, DishServed: 3}
+
+func (s DishStatus) Valid() bool {
+	_, ok := dishSteps[s]
+	return ok
+}
+
+// Before reports whether s comes earlier in the kitchen flow than other.
+func (s DishStatus) Before(other DishStatus) bool {
+	return dishSteps[s] < dishSteps[other]
+}
+
+// SetStatus moves the line to status and stamps the time of every step it
+// reaches, including skipped ones.
+func (f *OrderFood) SetStatus(status DishStatus, now time.Time) {
+	f.Status = status
+	if !status.Before(DishCooking) && f.CookingAt == nil {
+		f.CookingAt = &now
+	}
+	if !status.Before(DishReady) && f.ReadyAt == nil {
+		f.ReadyAt = &now
+	}
+	if !status.Before(DishServed) && f.ServedAt == nil {
+		f.ServedAt = &now
+	}
+}
+
+func SaveDishStatus(db *gorm.DB, f *OrderFood) error {
+	return db.Model(f).Select("status", "cooking_at", "ready_at", "served_at").Updates(f).Error
+}
+
+// migrateLegacyDishStatuses marks the lines of orders served before dishes
+// had a status of their own as served.
+func migrateLegacyDishStatuses(db *gorm.DB) error {
+	return db.Model(&OrderFood{}).
+		Where("status = ? AND order_id IN (?)", DishQueued, db.Model(&Order{}).Select("id").Where("status IN ?", CompletedOrderStatuses)).
+		UpdateColumn("status", DishServed).Error
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header so that a retry gets the same response instead of
+// repeating the request. Keys are chosen by clients, so they are only unique
+// within a Scope such as a table session.
+type IdempotencyKey struct {
+	Scope       string    `gorm:"primaryKey"`
+	Key         string    `gorm:"primaryKey"`
+	Fingerprint string    `gorm:"not null"`
+	StatusCode  int       `gorm:"not null"`
+	Response    []byte    `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginAttempt struct {
+	Key         string    `gorm:"primaryKey"`
+	Failures    int       `gorm:"not null"`
+	LastFailure time.Time `gorm:"not null"`
+	LockedUntil time.Time `gorm:"not null"`
+}
+
+type LoginEvent struct {
+	ID        string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	Login     string    `gorm:"index;not null" json:"login"`
+	UserID    *string   `gorm:"index" json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `gorm:"not null" json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created"`
+}
+
+// DBAttemptStore keeps login counters in Postgres so lockouts survive a
+// restart and are shared between several server processes.
+type DBAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewDBAttemptStore(db *gorm.DB) *DBAttemptStore {
+	return &DBAttemptStore{db: db}
+}
+
+func (s *DBAttemptStore) Get(key string) (utils.AttemptState, error) {
+	var row LoginAttempt
+	err := s.db.Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.AttemptState{}, nil
+	}
+	if err != nil {
+		return utils.AttemptState{}, err
+	}
+	return utils.AttemptState{Failures: row.Failures, LastFailure: row.LastFailure, LockedUntil: row.LockedUntil}, nil
+}
+
+func (s *DBAttemptStore) Set(key string, state utils.AttemptState) error {
+	row := LoginAttempt{Key: key, Failures: state.Failures, LastFailure: state.LastFailure, LockedUntil: state.LockedUntil}
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error
+}
+
+func (s *DBAttemptStore) Delete(key string) error {
+	return s.db.Where("key = ?", key).Delete(&LoginAttempt{}).Error
+}
+
+// Update locks the row of key for the rest of the transaction, creating it
+// first if needed, so concurrent updates of one key are applied in turn.
+func (s *DBAttemptStore) Update(key string, fn func(utils.AttemptState) utils.AttemptState) (utils.AttemptState, error) {
+	var state utils.AttemptState
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		row := LoginAttempt{Key: key}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+		state = fn(utils.AttemptState{Failures: row.Failures, LastFailure: row.LastFailure, LockedUntil: row.LockedUntil})
+		row.Failures, row.LastFailure, row.LockedUntil = state.Failures, state.LastFailure, state.LockedUntil
+		return tx.Save(&row).Error
+	})
+	return state, err
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -11,7 +12,7 @@ import (
 
 var DB *gorm.DB
 
-func ConnectDB() {
+func ConnectDB() error {
 	utils.LoadEnv()
 
 	host := utils.GetEnv("DB_HOST")
@@ -25,44 +26,59 @@ func ConnectDB() {
 		host, user, password, dbName, port, timeZone,
 	)
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
-		panic("failed to connect database")
+		return fmt.Errorf("failed to connect database: %w", err)
 	}
 	fmt.Println("Connected to PostgreSQL database!")
+	return nil
 }
 
-func MigrateDB() {
-	err := DB.AutoMigrate(&User{}, &Table{}, &Category{}, &Food{}, &Order{}, &OrderFood{}, &Feedback{})
+func MigrateDB() error {
+	err := DB.AutoMigrate(&Permission{}, &Role{}, &User{}, &Device{}, &Session{}, &UsedRefreshToken{}, &LoginAttempt{}, &LoginEvent{}, &Table{}, &TableSession{}, &Category{}, &Food{}, &Order{}, &OrderStatusHistory{}, &OrderFood{}, &Feedback{}, &AuditLog{}, &IdempotencyKey{}, &OrderSequence{}, &BillSplit{}, &Bill{}, &BillLine{}, &Payment{}, &FoodNotePreset{})
 	if err != nil {
-		panic("failed to migrate database")
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err := seedRoles(DB); err != nil {
+		return fmt.Errorf("failed to seed roles: %w", err)
+	}
+	if err := migrateLegacyOrderStatuses(DB); err != nil {
+		return fmt.Errorf("failed to migrate order statuses: %w", err)
+	}
+	if err := migrateLegacyDishStatuses(DB); err != nil {
+		return fmt.Errorf("failed to migrate dish statuses: %w", err)
+	}
+	if err := migrateLegacyOrderPrices(DB); err != nil {
+		return fmt.Errorf("failed to migrate order prices: %w", err)
+	}
+	if err := migrateLegacyOrderNumbers(DB); err != nil {
+		return fmt.Errorf("failed to number legacy orders: %w", err)
+	}
+	if err := migrateLegacyRefreshTokens(DB); err != nil {
+		return fmt.Errorf("failed to migrate refresh tokens: %w", err)
 	}
 	fmt.Println("Database migrated!")
-}
-
-type UserRole int
-
-const (
-	Admin UserRole = iota
-	Staff
-)
-
-func (r UserRole) String() string {
-	return [...]string{"Admin", "Staff"}[r]
+	return nil
 }
 
 type User struct {
-	ID        string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
-	Login     string    `gorm:"unique;not null" json:"login"`
-	Password  string    `json:"password" gorm:"not null"`
-	Role      UserRole  `json:"role" gorm:"default:0"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated"`
+	ID          string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	Login       string    `gorm:"unique;not null" json:"login"`
+	Password    string    `json:"-" gorm:"not null"`
+	DisplayName string    `json:"display_name"`
+	Phone       string    `json:"phone"`
+	PinHash     string    `json:"-"`
+	RoleID      *string   `json:"role_id"`
+	Role        *Role     `gorm:"foreignKey:RoleID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"role,omitempty" validate:"-"`
+	Active      bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated"`
 }
 
 type Table struct {
 	ID        string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
 	Number    uint      `gorm:"unique; not null" json:"number" validate:"required"`
+	QRKey     string    `gorm:"not null;default:replace(gen_random_uuid()::text, '-', '')" json:"-"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated"`
 }
@@ -97,44 +113,57 @@ type Food struct {
 	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated"`
 }
 type Order struct {
-	ID        string      `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
-	TableID   string      `gorm:"not null" json:"table_id" validate:"required"`
-	OrderId   string      `gorm:"" json:"order_id" validate:"-"`
-	Table     Table       `gorm:"foreignKey:TableID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"table" validate:"-"`
-	UserID    *string     `json:"user_id"`
-	User      User        `gorm:"foreignKey:UserID" json:"-" validate:"-"`
-	Total     uint        `gorm:"not null" json:"total"`
-	Status    string      `gorm:"not null" json:"status"`
-	CreatedAt time.Time   `gorm:"autoCreateTime" json:"created"`
-	UpdatedAt time.Time   `gorm:"autoUpdateTime" json:"updated"`
-	Feedback  *Feedback   `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"feedback"`
-	OrderFood []OrderFood `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"foods" validate:"-"`
+	ID             string        `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	TableID        string        `gorm:"not null" json:"table_id" validate:"required"`
+	OrderId        string        `gorm:"" json:"order_id" validate:"-"`
+	BusinessDay    time.Time     `gorm:"type:date;uniqueIndex:idx_orders_number" json:"business_day" validate:"-"`
+	Sequence       int           `gorm:"uniqueIndex:idx_orders_number" json:"sequence" validate:"-"`
+	Table          Table         `gorm:"foreignKey:TableID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"table" validate:"-"`
+	UserID         *string       `json:"user_id"`
+	User           User          `gorm:"foreignKey:UserID" json:"-" validate:"-"`
+	TableSessionID *string       `gorm:"index" json:"table_session_id"`
+	TableSession   *TableSession `gorm:"foreignKey:TableSessionID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"-" validate:"-"`
+	Status         OrderStatus   `gorm:"not null" json:"status"`
+	CancelReason   CancelReason  `json:"cancel_reason"`
+	Note           string        `gorm:"size:500" json:"note"`
+	StaffNote      string        `gorm:"size:500" json:"staff_note"`
+	CreatedAt      time.Time     `gorm:"autoCreateTime" json:"created"`
+	UpdatedAt      time.Time     `gorm:"autoUpdateTime" json:"updated"`
+	Feedback       *Feedback     `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"feedback"`
+	OrderFood      []OrderFood   `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"foods" validate:"-"`
+	// Subtotal, service charge, VAT and the Total the guest pays.
+	pricing.Breakdown
 }
 type OrderFood struct {
-	ID             string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
-	OrderID        string    `gorm:"not null" json:"order_id"`
-	FoodID         string    `gorm:"not null" json:"food_id" validate:"required"`
-	Quantity       uint      `gorm:"not null" json:"quantity" validate:"required"`
-	NameUz         string    `json:"name_uz"`
-	NameRu         string    `json:"name_ru"`
-	NameEn         string    `json:"name_en"`
-	DescriptionUz  string    `json:"description_uz" validate:"required"`
-	Description    string    `json:"description" gorm:"-"`
-	DescriptionRu  string    `json:"description_ru" validate:"required"`
-	DescriptionEn  string    `json:"description_en" validate:"required"`
-	CategoryNameUz string    `json:"category_name_uz" validate:"required"`
-	CategoryName   string    `json:"category_name" gorm:"-"`
-	CategoryNameRu string    `json:"category_name_ru" validate:"required"`
-	CategoryNameEn string    `json:"category_name_en" validate:"required"`
-	Name           string    `json:"name" gorm:"-"`
-	Price          uint      `json:"price"`
-	Image          string    `json:"image"`
-	Weight         float32   `json:"weight"`
-	WeightType     string    `json:"weight_type"`
-	Food           Food      `gorm:"foreignKey:FoodID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"-" validate:"-"`
-	Order          Order     `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"-" validate:"-"`
-	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created"`
-	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated"`
+	ID             string     `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	OrderID        string     `gorm:"not null" json:"order_id"`
+	FoodID         string     `gorm:"not null" json:"food_id" validate:"required"`
+	Quantity       uint       `gorm:"not null" json:"quantity" validate:"required"`
+	NameUz         string     `json:"name_uz"`
+	NameRu         string     `json:"name_ru"`
+	NameEn         string     `json:"name_en"`
+	DescriptionUz  string     `json:"description_uz" validate:"required"`
+	Description    string     `json:"description" gorm:"-"`
+	DescriptionRu  string     `json:"description_ru" validate:"required"`
+	DescriptionEn  string     `json:"description_en" validate:"required"`
+	CategoryNameUz string     `json:"category_name_uz" validate:"required"`
+	CategoryName   string     `json:"category_name" gorm:"-"`
+	CategoryNameRu string     `json:"category_name_ru" validate:"required"`
+	CategoryNameEn string     `json:"category_name_en" validate:"required"`
+	Name           string     `json:"name" gorm:"-"`
+	Price          uint       `json:"price"`
+	Image          string     `json:"image"`
+	Weight         float32    `json:"weight"`
+	WeightType     string     `json:"weight_type"`
+	Status         DishStatus `gorm:"not null;default:queued" json:"status"`
+	Note           string     `gorm:"size:200" json:"note"`
+	CookingAt      *time.Time `json:"cooking_at"`
+	ReadyAt        *time.Time `json:"ready_at"`
+	ServedAt       *time.Time `json:"served_at"`
+	Food           Food       `gorm:"foreignKey:FoodID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"-" validate:"-"`
+	Order          Order      `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE" json:"-" validate:"-"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated"`
 }
 type Feedback struct {
 	ID        string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
@@ -147,7 +176,3 @@ type Feedback struct {
 	Star      uint      `gorm:"type:int; check:star >= 1 AND star <= 5" json:"star" validate:"required,min=1,max=5"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created"`
 }
-type Login struct {
-	Login    string `json:"login" validate:"required"`
-	Password string `json:"password" validate:"required"`
-}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// FoodNotePreset is a quick note guests can pick when ordering a food, such
+// as "no onions" or "extra spicy".
+type FoodNotePreset struct {
+	ID        string    `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	FoodID    string    `gorm:"not null;index" json:"food_id"`
+	Food      Food      `gorm:"foreignKey:FoodID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	NameUz    string    `gorm:"size:200" json:"name_uz"`
+	Name      string    `gorm:"-" json:"name"`
+	NameRu    string    `gorm:"size:200" json:"name_ru"`
+	NameEn    string    `gorm:"size:200" json:"name_en"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created"`
+}
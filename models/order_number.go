@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"gorm.io/gorm"
+)
+
+// OrderSequence holds the last order number handed out on a business day.
+type OrderSequence struct {
+	BusinessDay time.Time `gorm:"type:date;primaryKey"`
+	LastNumber  int       `gorm:"not null"`
+}
+
+// NextOrderSequence allocates the next number of the business day. The
+// counter row stays locked until tx ends, so concurrent orders get distinct
+// numbers and a rolled back order does not leave a gap.
+func NextOrderSequence(tx *gorm.DB, businessDay time.Time) (int, error) {
+	var next int
+	err := tx.Raw(`INSERT INTO order_sequences (business_day, last_number) VALUES (?, 1)
+		ON CONFLICT (business_day) DO UPDATE SET last_number = order_sequences.last_number + 1
+		RETURNING last_number`, businessDay).Scan(&next).Error
+	return next, err
+}
+
+// migrateLegacyOrderNumbers numbers orders placed before sequences existed
+// in the order they were created on each business day, keeping their old
+// random order_id, and moves the counters past them. Business days start at
+// BUSINESS_DAY_START, as for new orders.
+func migrateLegacyOrderNumbers(db *gorm.DB) error {
+	numbering, err := utils.NewOrderNumberingFromEnv()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE orders SET business_day = numbered.day, sequence = numbered.n
+			FROM (SELECT legacy.id, legacy.day,
+				(SELECT COALESCE(MAX(o.sequence), 0) FROM orders o WHERE o.business_day = legacy.day)
+					+ ROW_NUMBER() OVER (PARTITION BY legacy.day ORDER BY legacy.created_at) AS n
+				FROM (SELECT id, created_at, (created_at - make_interval(secs => ?))::date AS day
+					FROM orders WHERE business_day IS NULL) AS legacy) AS numbered
+			WHERE orders.id = numbered.id`, numbering.DayStart.Seconds()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO order_sequences (business_day, last_number)
+			SELECT business_day, MAX(sequence) FROM orders WHERE business_day IS NOT NULL GROUP BY business_day
+			ON CONFLICT (business_day) DO UPDATE SET last_number = GREATEST(order_sequences.last_number, EXCLUDED.last_number)`).Error
+	})
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
+	"gorm.io/gorm"
+)
+
+var orderPriceColumns = []string{"subtotal", "service_charge_rate", "service_charge", "vat_rate", "vat_included", "vat", "rounding", "total"}
+
+func PricingLines(foods []OrderFood) []pricing.Line {
+	lines := make([]pricing.Line, len(foods))
+	for i, f := range foods {
+		lines[i] = pricing.Line{Price: f.Price, Quantity: f.Quantity}
+	}
+	return lines
+}
+
+// PriceOrder prices the order's lines with the current settings and saves
+// the breakdown.
+func PriceOrder(tx *gorm.DB, order *Order) error {
+	breakdown, err := pricing.Current.Price(PricingLines(order.OrderFood))
+	if err != nil {
+		return err
+	}
+	order.Breakdown = breakdown
+	return tx.Model(order).Select(orderPriceColumns).Updates(order).Error
+}
+
+// migrateLegacyOrderPrices gives orders placed before the breakdown existed
+// a subtotal equal to the total they were charged.
+func migrateLegacyOrderPrices(db *gorm.DB) error {
+	return db.Model(&Order{}).Where("subtotal = 0 AND total > 0").UpdateColumn("subtotal", gorm.Expr("total")).Error
+}
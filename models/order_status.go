@@ -0,0 +1,147 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderAccepted  OrderStatus = "accepted"
+	OrderCooking   OrderStatus = "cooking"
+	OrderReady     OrderStatus = "ready"
+	OrderServed    OrderStatus = "served"
+	OrderPaid      OrderStatus = "paid"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderRejected  OrderStatus = "rejected"
+)
+
+// CancelReason is required when an order is cancelled or rejected.
+// CancelGuestRequest is only set by the guest cancellation endpoint.
+type CancelReason string
+
+const (
+	CancelOutOfStock   CancelReason = "out_of_stock"
+	CancelGuestLeft    CancelReason = "guest_left"
+	CancelDuplicate    CancelReason = "duplicate"
+	CancelGuestRequest CancelReason = "guest_request"
+)
+
+// StaffCancelReasons are the reasons staff can choose from.
+var StaffCancelReasons = []CancelReason{CancelOutOfStock, CancelGuestLeft, CancelDuplicate}
+
+func (r CancelReason) ValidForStaff() bool {
+	for _, reason := range StaffCancelReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderTransition describes one allowed status change. Permission is the
+// permission the acting user's role needs. When AssigneeOnly is set and the
+// order is assigned, only the assigned user may make the change.
+type OrderTransition struct {
+	Permission   string
+	AssigneeOnly bool
+}
+
+// OrderTransitions is the order state machine:
+//
+//	pending → accepted → cooking → ready → served → paid
+//
+// Until it is served, an order can be rejected by the kitchen or cancelled
+// by a user allowed to cancel orders. Guests cancel their own pending orders
+// through a separate endpoint.
+var OrderTransitions = map[OrderStatus]map[OrderStatus]OrderTransition{
+	OrderPending: {
+		OrderAccepted:  {Permission: PermOrdersClaim},
+		OrderRejected:  {Permission: PermOrdersUpdate},
+		OrderCancelled: {Permission: PermOrdersCancel},
+	},
+	OrderAccepted: {
+		OrderCooking:   {Permission: PermOrdersUpdate, AssigneeOnly: true},
+		OrderRejected:  {Permission: PermOrdersUpdate},
+		OrderCancelled: {Permission: PermOrdersCancel},
+	},
+	OrderCooking: {
+		OrderReady:     {Permission: PermOrdersUpdate, AssigneeOnly: true},
+		OrderRejected:  {Permission: PermOrdersUpdate},
+		OrderCancelled: {Permission: PermOrdersCancel},
+	},
+	OrderReady: {
+		OrderServed:    {Permission: PermOrdersUpdate, AssigneeOnly: true},
+		OrderRejected:  {Permission: PermOrdersUpdate},
+		OrderCancelled: {Permission: PermOrdersCancel},
+	},
+	OrderServed: {
+		OrderPaid: {Permission: PermOrdersPay},
+	},
+}
+
+// OrderStatuses lists every status an order can have.
+var OrderStatuses = []OrderStatus{OrderPending, OrderAccepted, OrderCooking, OrderReady, OrderServed, OrderPaid, OrderCancelled, OrderRejected}
+
+// OpenOrderStatuses are the statuses of orders staff still have to act on.
+var OpenOrderStatuses = []OrderStatus{OrderPending, OrderAccepted, OrderCooking, OrderReady, OrderServed}
+
+// CompletedOrderStatuses are the statuses of orders that count as sales.
+var CompletedOrderStatuses = []OrderStatus{OrderServed, OrderPaid}
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderPending, OrderAccepted, OrderCooking, OrderReady, OrderServed, OrderPaid, OrderCancelled, OrderRejected:
+		return true
+	}
+	return false
+}
+
+// NeedsReason reports whether moving to s requires a CancelReason.
+func (s OrderStatus) NeedsReason() bool {
+	return s == OrderCancelled || s == OrderRejected
+}
+
+func (s OrderStatus) Final() bool {
+	return len(OrderTransitions[s]) == 0
+}
+
+func FindOrderTransition(from, to OrderStatus) (OrderTransition, bool) {
+	t, ok := OrderTransitions[from][to]
+	return t, ok
+}
+
+// OrderStatusHistory records every status an order went through. From is
+// empty for the entry written when the order is placed; ActorID is nil for
+// changes made by guests.
+type OrderStatusHistory struct {
+	ID        string       `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	OrderID   string       `gorm:"not null;index" json:"order_id"`
+	Order     Order        `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	From      OrderStatus  `json:"from"`
+	To        OrderStatus  `gorm:"not null" json:"to"`
+	Reason    CancelReason `json:"reason"`
+	ActorID   *string      `gorm:"index" json:"actor_id"`
+	Actor     *User        `gorm:"foreignKey:ActorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"-"`
+	CreatedAt time.Time    `gorm:"autoCreateTime" json:"created"`
+}
+
+func RecordOrderStatus(db *gorm.DB, orderID string, from, to OrderStatus, actorID *string) error {
+	return RecordOrderStatusWithReason(db, orderID, from, to, "", actorID)
+}
+
+func RecordOrderStatusWithReason(db *gorm.DB, orderID string, from, to OrderStatus, reason CancelReason, actorID *string) error {
+	return db.Create(&OrderStatusHistory{OrderID: orderID, From: from, To: to, Reason: reason, ActorID: actorID}).Error
+}
+
+// migrateLegacyOrderStatuses maps the statuses used before the state machine
+// existed: a claimed order was "in_process" and a delivered one "done".
+func migrateLegacyOrderStatuses(db *gorm.DB) error {
+	if err := db.Model(&Order{}).Where("status = ?", "in_process").UpdateColumn("status", OrderAccepted).Error; err != nil {
+		return err
+	}
+	return db.Model(&Order{}).Where("status = ?", "done").UpdateColumn("status", OrderServed).Error
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/payments"
+	"gorm.io/gorm"
+)
+
+// Payment is one amount paid, or being paid, towards an order or, when the
+// order was split, towards one of its bills. Either can be paid in parts and
+// with several methods.
+type Payment struct {
+	ID          string          `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	OrderID     *string         `gorm:"index" json:"order_id"`
+	Order       *Order          `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	BillID      *string         `gorm:"index" json:"bill_id"`
+	Bill        *Bill           `gorm:"foreignKey:BillID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Amount      uint            `gorm:"not null" json:"amount"`
+	Method      payments.Method `gorm:"not null" json:"method"`
+	Provider    string          `gorm:"not null;index:idx_payments_provider_ref" json:"provider"`
+	ProviderRef string          `gorm:"index:idx_payments_provider_ref" json:"provider_ref"`
+	PayURL      string          `json:"pay_url,omitempty"`
+	Status      payments.Status `gorm:"not null" json:"status"`
+	ActorID     *string         `gorm:"index" json:"actor_id"`
+	Actor       *User           `gorm:"foreignKey:ActorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"-"`
+	SettledAt   *time.Time      `json:"settled_at"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created"`
+	UpdatedAt   time.Time       `gorm:"autoUpdateTime" json:"updated"`
+}
+
+// PaidAmounts returns what confirmed payments matching of, such as
+// Payment{OrderID: &id}, cover and what pending ones may still add.
+func PaidAmounts(db *gorm.DB, of Payment) (confirmed, pending uint, err error) {
+	var sums []struct {
+		Status payments.Status
+		Sum    uint
+	}
+	err = db.Model(&Payment{}).
+		Select("status, COALESCE(SUM(amount), 0) AS sum").
+		Where(&of).
+		Where("status IN ?", []payments.Status{payments.StatusConfirmed, payments.StatusPending}).
+		Group("status").
+		Scan(&sums).Error
+	for _, s := range sums {
+		if s.Status == payments.StatusConfirmed {
+			confirmed = s.Sum
+		} else {
+			pending = s.Sum
+		}
+	}
+	return confirmed, pending, err
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PermMenuEdit     = "menu.edit"
+	PermTablesView   = "tables.view"
+	PermTablesManage = "tables.manage"
+	PermTablesClose  = "tables.close"
+	PermOrdersView   = "orders.view"
+	PermOrdersClaim  = "orders.claim"
+	PermOrdersUpdate = "orders.update"
+	PermOrdersCancel = "orders.cancel"
+	PermOrdersPay    = "orders.pay"
+	PermOrdersDelete = "orders.delete"
+	PermKitchenCook  = "kitchen.cook"
+	PermReportsView  = "reports.view"
+	PermStaffManage  = "staff.manage"
+	PermDeviceManage = "devices.manage"
+	PermAuditView    = "audit.view"
+)
+
+const (
+	AdminRoleName = "admin"
+	StaffRoleName = "staff"
+)
+
+type Permission struct {
+	Code        string `gorm:"primaryKey" json:"code"`
+	Description string `json:"description"`
+}
+
+type Role struct {
+	ID          string       `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	Name        string       `gorm:"unique;not null" json:"name"`
+	System      bool         `gorm:"default:false" json:"system"`
+	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"permissions"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"created"`
+	UpdatedAt   time.Time    `gorm:"autoUpdateTime" json:"updated"`
+}
+
+func (r *Role) Has(code string) bool {
+	for _, p := range r.Permissions {
+		if p.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Role) PermissionCodes() []string {
+	codes := make([]string, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		codes = append(codes, p.Code)
+	}
+	return codes
+}
+
+var Permissions = []Permission{
+	{Code: PermMenuEdit, Description: "Create, update and delete categories and foods"},
+	{Code: PermTablesView, Description: "List tables"},
+	{Code: PermTablesManage, Description: "Create, update and delete tables"},
+	{Code: PermTablesClose, Description: "Close guest sessions of tables"},
+	{Code: PermOrdersView, Description: "See the order queue"},
+	{Code: PermOrdersClaim, Description: "Claim pending orders"},
+	{Code: PermOrdersUpdate, Description: "Change the status of claimed orders"},
+	{Code: PermOrdersCancel, Description: "Cancel orders"},
+	{Code: PermOrdersPay, Description: "Mark served orders as paid"},
+	{Code: PermOrdersDelete, Description: "Delete the order history"},
+	{Code: PermKitchenCook, Description: "Change the kitchen status of single dishes"},
+	{Code: PermReportsView, Description: "View the dashboard and reports"},
+	{Code: PermStaffManage, Description: "Manage staff accounts and roles"},
+	{Code: PermDeviceManage, Description: "Register and revoke shared tablets"},
+	{Code: PermAuditView, Description: "Read and export the audit log"},
+}
+
+// defaultRoles lists the permissions each built-in role receives. The admin
+// role is not listed: it always holds every permission.
+var defaultRoles = map[string][]string{
+	StaffRoleName: {PermTablesView, PermTablesClose, PermOrdersView, PermOrdersClaim, PermOrdersUpdate, PermKitchenCook},
+}
+
+func IsPermission(code string) bool {
+	for _, p := range Permissions {
+		if p.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// seedRoles makes sure every known permission and the built-in roles exist.
+// A permission seen for the first time is granted to the built-in roles that
+// list it, so admins keep any changes they made to those roles later.
+func seedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var added []string
+		for _, p := range Permissions {
+			res := tx.Where(Permission{Code: p.Code}).Attrs(Permission{Description: p.Description}).FirstOrCreate(&Permission{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				added = append(added, p.Code)
+			}
+		}
+
+		admin := Role{}
+		if err := tx.Where(Role{Name: AdminRoleName}).Attrs(Role{System: true}).FirstOrCreate(&admin).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&admin).Association("Permissions").Replace(Permissions); err != nil {
+			return err
+		}
+
+		for name, codes := range defaultRoles {
+			role := Role{}
+			res := tx.Where(Role{Name: name}).Attrs(Role{System: true}).FirstOrCreate(&role)
+			if res.Error != nil {
+				return res.Error
+			}
+			grant := added
+			if res.RowsAffected > 0 {
+				grant = codes
+			}
+			var perms []Permission
+			for _, code := range grant {
+				for _, c := range codes {
+					if c == code {
+						perms = append(perms, Permission{Code: code})
+					}
+				}
+			}
+			if len(perms) == 0 {
+				continue
+			}
+			if err := tx.Model(&role).Association("Permissions").Append(perms); err != nil {
+				return err
+			}
+		}
+		return migrateLegacyRoles(tx, admin.ID)
+	})
+}
+
+// migrateLegacyRoles moves users from the old integer role column
+// (0 = Admin, 1 = Staff) to role_id and drops the column.
+func migrateLegacyRoles(tx *gorm.DB, adminRoleID string) error {
+	var staff Role
+	if err := tx.Where("name = ?", StaffRoleName).First(&staff).Error; err != nil {
+		return err
+	}
+	if tx.Migrator().HasColumn("users", "role") {
+		if err := tx.Exec("UPDATE users SET role_id = ? WHERE role_id IS NULL AND role = 0", adminRoleID).Error; err != nil {
+			return fmt.Errorf("migrate admin users: %w", err)
+		}
+		if err := tx.Migrator().DropColumn("users", "role"); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&User{}).Where("role_id IS NULL").Update("role_id", staff.ID).Error
+}
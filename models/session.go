@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session backs one refresh token. Access tokens carry the session ID, so
+// revoking the session logs the device out on its next request. DeviceID is
+// set for PIN sessions, which only work together with the token of the tablet
+// they were opened on.
+type Session struct {
+	ID               string     `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID           string     `gorm:"not null;index" json:"user_id"`
+	User             User       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	RefreshTokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	DeviceID         *string    `gorm:"index" json:"device_id"`
+	Device           *Device    `gorm:"foreignKey:DeviceID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	UserAgent        string     `json:"user_agent"`
+	IP               string     `json:"ip"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created"`
+}
+
+// UsedRefreshToken remembers every refresh token a session rotated away. One
+// presented again has leaked, so the session it belonged to is revoked.
+type UsedRefreshToken struct {
+	Hash      string    `gorm:"primaryKey" json:"-"`
+	SessionID string    `gorm:"not null;index" json:"session_id"`
+	Session   Session   `gorm:"foreignKey:SessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created"`
+}
+
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+func RevokeUserSessions(db *gorm.DB, userID string) error {
+	return db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID, which
+// belongs to the request that triggered the revocation.
+func RevokeOtherSessions(db *gorm.DB, userID, keepID string) error {
+	return db.Model(&Session{}).
+		Where("user_id = ? AND ID <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// migrateLegacyRefreshTokens moves the single rotated-away token sessions
+// used to keep in previous_token_hash to used_refresh_tokens and drops the
+// column.
+func migrateLegacyRefreshTokens(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("sessions", "previous_token_hash") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO used_refresh_tokens (hash, session_id, created_at)
+			SELECT previous_token_hash, id, last_used_at FROM sessions WHERE previous_token_hash <> ''
+			ON CONFLICT DO NOTHING`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn("sessions", "previous_token_hash")
+	})
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TableSession is opened when guests scan the QR code of a table and closed
+// by staff when they leave. A table has at most one open session; guests who
+// scan later join it. A session nobody used for the idle timeout no longer
+// accepts requests and is closed the next time the table is scanned.
+type TableSession struct {
+	ID         string     `gorm:"primaryKey;default:gen_random_uuid()" json:"id"`
+	TableID    string     `gorm:"not null;uniqueIndex:idx_table_sessions_open,where:closed_at IS NULL" json:"table_id"`
+	Table      Table      `gorm:"foreignKey:TableID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"table"`
+	LastSeenAt time.Time  `gorm:"not null" json:"last_seen_at"`
+	ClosedAt   *time.Time `json:"closed_at"`
+	ClosedByID *string    `json:"closed_by_id"`
+	ClosedBy   *User      `gorm:"foreignKey:ClosedByID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"-"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created"`
+}
+
+func (s *TableSession) Active(now time.Time, idle time.Duration) bool {
+	return s.ClosedAt == nil && now.Sub(s.LastSeenAt) < idle
+}
+
+func CloseTableSession(db *gorm.DB, session *TableSession, closedBy *string) error {
+	now := time.Now()
+	session.ClosedAt = &now
+	session.ClosedByID = closedBy
+	return db.Model(session).Select("closed_at", "closed_by_id").Updates(session).Error
+}
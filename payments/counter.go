@@ -0,0 +1,34 @@
+package payments
+
+import (
+	"context"
+	"net/http"
+)
+
+// Counter takes money at the table: cash is paid once it is recorded, a card
+// payment once staff confirm the terminal slip.
+type Counter struct {
+	name           string
+	paidOnInitiate bool
+}
+
+func (c Counter) Name() string {
+	return c.name
+}
+
+func (c Counter) Initiate(ctx context.Context, req Request) (Initiation, error) {
+	if c.paidOnInitiate {
+		return Initiation{Status: StatusConfirmed}, nil
+	}
+	return Initiation{Status: StatusPending}, nil
+}
+
+// Status is asked when staff confirm the payment, which is all the evidence
+// there is.
+func (c Counter) Status(ctx context.Context, reference string) (Status, error) {
+	return StatusConfirmed, nil
+}
+
+func (c Counter) Callback(r *http.Request) (Callback, error) {
+	return Callback{}, ErrNoCallbacks
+}
@@ -0,0 +1,141 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+)
+
+// FakeServer is a local stand-in for a wallet provider. It keeps invoices in
+// memory. Opening an invoice's pay_url with POST, optionally with
+// ?result=fail, settles it and sends a signed callback, as a guest paying in
+// their wallet app would.
+type FakeServer struct {
+	publicURL string
+	secret    []byte
+	client    *http.Client
+
+	mu       sync.Mutex
+	invoices map[string]*fakeInvoice
+}
+
+func NewFakeServer(publicURL, secret string) *FakeServer {
+	return &FakeServer{
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		secret:    []byte(secret),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		invoices:  map[string]*fakeInvoice{},
+	}
+}
+
+func (s *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case r.Method == http.MethodPost && path == "invoices":
+		s.create(w, r)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "invoices":
+		s.get(w, parts[1])
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "invoices" && parts[2] == "pay":
+		s.pay(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *FakeServer) create(w http.ResponseWriter, r *http.Request) {
+	var invoice fakeInvoice
+	if err := json.NewDecoder(r.Body).Decode(&invoice); err != nil || invoice.Amount == 0 {
+		http.Error(w, "amount is required", http.StatusBadRequest)
+		return
+	}
+	id, err := utils.RandomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invoice.ID = id[:16]
+	invoice.PayURL = s.publicURL + "/invoices/" + invoice.ID + "/pay"
+	invoice.Status = StatusPending
+	s.mu.Lock()
+	s.invoices[invoice.ID] = &invoice
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, invoice)
+}
+
+func (s *FakeServer) get(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	invoice, ok := s.invoices[id]
+	var copied fakeInvoice
+	if ok {
+		copied = *invoice
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "invoice not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, copied)
+}
+
+func (s *FakeServer) pay(w http.ResponseWriter, r *http.Request, id string) {
+	status := StatusConfirmed
+	if r.URL.Query().Get("result") == "fail" {
+		status = StatusFailed
+	}
+	s.mu.Lock()
+	invoice, ok := s.invoices[id]
+	if ok && !invoice.Status.Final() {
+		invoice.Status = status
+	}
+	var copied fakeInvoice
+	if ok {
+		copied = *invoice
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "invoice not found", http.StatusNotFound)
+		return
+	}
+	if copied.CallbackURL != "" {
+		if err := s.notify(copied); err != nil {
+			log.Printf("fakepay: callback for %s failed: %v", copied.ID, err)
+		}
+	}
+	writeJSON(w, http.StatusOK, copied)
+}
+
+func (s *FakeServer) notify(invoice fakeInvoice) error {
+	body, err := json.Marshal(invoice)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, invoice.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, hex.EncodeToString(sign(s.secret, body)))
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		log.Printf("fakepay: callback for %s answered %s", invoice.ID, res.Status)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
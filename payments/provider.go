@@ -0,0 +1,137 @@
+// Package payments talks to the ways a bill can be paid. Each Method is
+// served by a Provider; the views record the payments themselves.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+)
+
+type Method string
+
+const (
+	MethodCash  Method = "cash"
+	MethodCard  Method = "card"
+	MethodClick Method = "click"
+	MethodPayme Method = "payme"
+)
+
+var Methods = []Method{MethodCash, MethodCard, MethodClick, MethodPayme}
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusConfirmed Status = "confirmed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+func (s Status) Final() bool {
+	return s != StatusPending
+}
+
+type Request struct {
+	PaymentID   string
+	Amount      uint
+	Description string
+	// CallbackURL is where the provider reports the outcome, if it does.
+	CallbackURL string
+}
+
+type Initiation struct {
+	Reference string
+	// PayURL is the page the guest pays on, for wallets.
+	PayURL string
+	Status Status
+}
+
+type Callback struct {
+	Reference string
+	Status    Status
+}
+
+var ErrNoCallbacks = errors.New("provider does not send callbacks")
+
+// Provider is one way of taking money. Initiate starts a payment, Status asks
+// the provider how it went, and Callback reads and authenticates a
+// notification the provider sent to us.
+type Provider interface {
+	Name() string
+	Initiate(ctx context.Context, req Request) (Initiation, error)
+	Status(ctx context.Context, reference string) (Status, error)
+	Callback(r *http.Request) (Callback, error)
+}
+
+var (
+	providers = map[Method]Provider{
+		MethodCash: Counter{name: "cash", paidOnInitiate: true},
+		MethodCard: Counter{name: "card_terminal"},
+	}
+	callbackURL string
+)
+
+// Init reads:
+//
+//	PAYMENT_CALLBACK_URL  public URL of /v1/payment/callback, required for
+//	                      wallets
+//	PAYMENT_FAKE_URL      URL of the stand-in started by `manage fakepay`;
+//	                      when set, Click and Payme are served by it
+//	PAYMENT_FAKE_SECRET   secret the stand-in signs its callbacks with
+func Init() error {
+	callbackURL = strings.TrimSuffix(utils.GetEnv("PAYMENT_CALLBACK_URL"), "/")
+	delete(providers, MethodClick)
+	delete(providers, MethodPayme)
+	if url := utils.GetEnv("PAYMENT_FAKE_URL"); url != "" {
+		secret := utils.GetEnv("PAYMENT_FAKE_SECRET")
+		if secret == "" {
+			return errors.New("PAYMENT_FAKE_SECRET must be set with PAYMENT_FAKE_URL")
+		}
+		if callbackURL == "" {
+			return errors.New("PAYMENT_CALLBACK_URL must be set with PAYMENT_FAKE_URL")
+		}
+		fake := NewFake(url, secret)
+		providers[MethodClick] = fake
+		providers[MethodPayme] = fake
+	}
+	return nil
+}
+
+func (m Method) Valid() bool {
+	for _, method := range Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// For returns the provider serving method, if it is configured.
+func For(method Method) (Provider, error) {
+	if provider, ok := providers[method]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("payment method %q is not configured", method)
+}
+
+// Named returns the provider that answers to callbacks for name.
+func Named(name string) (Provider, bool) {
+	for _, provider := range providers {
+		if provider.Name() == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+func CallbackURL(provider Provider) string {
+	if callbackURL == "" {
+		return ""
+	}
+	return callbackURL + "/" + provider.Name()
+}
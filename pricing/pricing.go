@@ -0,0 +1,247 @@
+// Package pricing turns order lines into the amounts printed on a bill. All
+// amounts are whole so'm.
+package pricing
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+)
+
+// MaxAmount is the largest subtotal Price accepts. It is far above any real
+// bill and keeps every step of the calculation clear of overflow.
+const MaxAmount = 100_000_000_000_000
+
+var ErrTooLarge = errors.New("amount is too large")
+
+// Rate is a percentage in hundredths of a percent, so 12.5% is 1250.
+type Rate uint
+
+func ParseRate(value string) (Rate, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("%q is not a percentage between 0 and 100", value)
+	}
+	return Rate(math.Round(percent * 100)), nil
+}
+
+func (r Rate) Percent() float64 {
+	return float64(r) / 100
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Percent())
+}
+
+// of returns the rate of amount, rounded half up.
+func (r Rate) of(amount uint) uint {
+	return divRound(uint64(amount)*uint64(r), 10000)
+}
+
+type Settings struct {
+	ServiceCharge Rate
+	VAT           Rate
+	// VATIncluded means menu prices already contain VAT, so VAT is only
+	// reported. Otherwise it is added on top.
+	VATIncluded bool
+	// RoundTo is the step the total is rounded to, such as 100 or 1000 so'm.
+	RoundTo uint
+}
+
+var Roundings = []uint{1, 100, 1000}
+
+var Current = Settings{VATIncluded: true, RoundTo: 1}
+
+func Init() error {
+	settings, err := NewSettingsFromEnv()
+	if err != nil {
+		return err
+	}
+	Current = settings
+	return nil
+}
+
+// NewSettingsFromEnv reads:
+//
+//	SERVICE_CHARGE_PERCENT  defaults to 0
+//	VAT_PERCENT             defaults to 0
+//	VAT_MODE                "included" (default) or "added"
+//	PRICE_ROUNDING          1 (default), 100 or 1000
+func NewSettingsFromEnv() (Settings, error) {
+	settings := Settings{VATIncluded: true, RoundTo: 1}
+	var err error
+	if value := utils.GetEnv("SERVICE_CHARGE_PERCENT"); value != "" {
+		if settings.ServiceCharge, err = ParseRate(value); err != nil {
+			return settings, fmt.Errorf("SERVICE_CHARGE_PERCENT: %w", err)
+		}
+	}
+	if value := utils.GetEnv("VAT_PERCENT"); value != "" {
+		if settings.VAT, err = ParseRate(value); err != nil {
+			return settings, fmt.Errorf("VAT_PERCENT: %w", err)
+		}
+	}
+	switch mode := utils.GetEnv("VAT_MODE"); mode {
+	case "", "included":
+	case "added":
+		settings.VATIncluded = false
+	default:
+		return settings, fmt.Errorf("VAT_MODE must be included or added, got %q", mode)
+	}
+	if value := utils.GetEnv("PRICE_ROUNDING"); value != "" {
+		step, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || !slices.Contains(Roundings, uint(step)) {
+			return settings, fmt.Errorf("PRICE_ROUNDING must be one of %v, got %q", Roundings, value)
+		}
+		settings.RoundTo = uint(step)
+	}
+	return settings, nil
+}
+
+type Line struct {
+	Price    uint
+	Quantity uint
+}
+
+// Amount is Price times Quantity, or ErrTooLarge above MaxAmount.
+func (l Line) Amount() (uint, error) {
+	hi, lo := bits.Mul64(uint64(l.Price), uint64(l.Quantity))
+	if hi != 0 || lo > MaxAmount {
+		return 0, ErrTooLarge
+	}
+	return uint(lo), nil
+}
+
+// Breakdown is stored on every order, so a bill keeps the rates it was
+// priced with when the settings change later.
+type Breakdown struct {
+	Subtotal          uint `gorm:"not null;default:0" json:"subtotal"`
+	ServiceChargeRate Rate `gorm:"not null;default:0" json:"service_charge_rate"`
+	ServiceCharge     uint `gorm:"not null;default:0" json:"service_charge"`
+	VATRate           Rate `gorm:"not null;default:0" json:"vat_rate"`
+	VATIncluded       bool `gorm:"not null;default:true" json:"vat_included"`
+	VAT               uint `gorm:"not null;default:0" json:"vat"`
+	// Rounding is what rounding added to, or took off, the total.
+	Rounding int  `gorm:"not null;default:0" json:"rounding"`
+	Total    uint `gorm:"not null" json:"total"`
+}
+
+// Price computes the bill for lines: the service charge is taken on the
+// subtotal, VAT on the subtotal plus service charge, and the result is
+// rounded half up to RoundTo. A subtotal above MaxAmount is refused with
+// ErrTooLarge.
+func (s Settings) Price(lines []Line) (Breakdown, error) {
+	b := Breakdown{
+		ServiceChargeRate: s.ServiceCharge,
+		VATRate:           s.VAT,
+		VATIncluded:       s.VATIncluded,
+	}
+	for _, line := range lines {
+		amount, err := line.Amount()
+		if err != nil {
+			return b, err
+		}
+		if b.Subtotal += amount; b.Subtotal > MaxAmount {
+			return b, ErrTooLarge
+		}
+	}
+	b.ServiceCharge = s.ServiceCharge.of(b.Subtotal)
+	gross := b.Subtotal + b.ServiceCharge
+	if s.VATIncluded {
+		b.VAT = divRound(uint64(gross)*uint64(s.VAT), 10000+uint64(s.VAT))
+	} else {
+		b.VAT = s.VAT.of(gross)
+		gross += b.VAT
+	}
+	b.Total = round(gross, s.RoundTo)
+	b.Rounding = int(b.Total) - int(gross)
+	return b, nil
+}
+
+// Sum adds breakdowns up, for reports and for bills made of several orders.
+// Rates are kept only when every breakdown used the same ones.
+func Sum(breakdowns ...Breakdown) Breakdown {
+	var sum Breakdown
+	for i, b := range breakdowns {
+		if i == 0 {
+			sum.ServiceChargeRate, sum.VATRate, sum.VATIncluded = b.ServiceChargeRate, b.VATRate, b.VATIncluded
+		} else if sum.ServiceChargeRate != b.ServiceChargeRate || sum.VATRate != b.VATRate || sum.VATIncluded != b.VATIncluded {
+			sum.ServiceChargeRate, sum.VATRate = 0, 0
+		}
+		sum.Subtotal += b.Subtotal
+		sum.ServiceCharge += b.ServiceCharge
+		sum.VAT += b.VAT
+		sum.Rounding += b.Rounding
+		sum.Total += b.Total
+	}
+	return sum
+}
+
+func round(amount, step uint) uint {
+	if step <= 1 {
+		return amount
+	}
+	return divRound(uint64(amount), uint64(step)) * step
+}
+
+func divRound(n, d uint64) uint {
+	return uint((n + d/2) / d)
+}
+
+// Allocate divides total into parts proportional to weights, in multiples of
+// step, so that the parts add up to total exactly. Leftover steps go to the
+// parts that lost most to truncation, and whatever total has beyond a whole
+// number of steps goes to the largest part. With no weight at all the total
+// is divided equally.
+func Allocate(total uint, weights []uint64, step uint) []uint {
+	parts := make([]uint, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+	if step == 0 {
+		step = 1
+	}
+	var sum uint64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 {
+		weights = slices.Repeat([]uint64{1}, len(weights))
+		sum = uint64(len(weights))
+	}
+	units := uint64(total / step)
+	remainders := make([]uint64, len(weights))
+	order := make([]int, len(weights))
+	var given uint64
+	for i, w := range weights {
+		// units*w can exceed 64 bits; w <= sum keeps the quotient in range.
+		hi, lo := bits.Mul64(units, w)
+		quotient, remainder := bits.Div64(hi, lo, sum)
+		parts[i] = uint(quotient) * step
+		remainders[i] = remainder
+		given += quotient
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(remainders[b], remainders[a])
+	})
+	for k := 0; given < units; k++ {
+		parts[order[k]] += step
+		given++
+	}
+	largest := 0
+	for i, p := range parts {
+		if p > parts[largest] {
+			largest = i
+		}
+	}
+	parts[largest] += total % step
+	return parts
+}
@@ -0,0 +1,151 @@
+package pricing
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestPrice(t *testing.T) {
+	lines := []Line{{Price: 10000, Quantity: 2}, {Price: 5000, Quantity: 1}}
+	tests := []struct {
+		name     string
+		settings Settings
+		lines    []Line
+		want     Breakdown
+	}{
+		{
+			name:     "VAT included",
+			settings: Settings{VAT: 1200, VATIncluded: true, RoundTo: 1},
+			lines:    lines,
+			want:     Breakdown{Subtotal: 25000, VATRate: 1200, VATIncluded: true, VAT: 2679, Total: 25000},
+		},
+		{
+			name:     "VAT added",
+			settings: Settings{VAT: 1200, RoundTo: 1},
+			lines:    lines,
+			want:     Breakdown{Subtotal: 25000, VATRate: 1200, VAT: 3000, Total: 28000},
+		},
+		{
+			name:     "service charge before VAT",
+			settings: Settings{ServiceCharge: 1000, VAT: 1200, RoundTo: 1},
+			lines:    lines,
+			want:     Breakdown{Subtotal: 25000, ServiceChargeRate: 1000, ServiceCharge: 2500, VATRate: 1200, VAT: 3300, Total: 30800},
+		},
+		{
+			name:     "rounded down to 100",
+			settings: Settings{VAT: 1200, RoundTo: 100},
+			lines:    []Line{{Price: 12345, Quantity: 1}},
+			want:     Breakdown{Subtotal: 12345, VATRate: 1200, VAT: 1481, Rounding: -26, Total: 13800},
+		},
+		{
+			name:     "rounded up to 1000",
+			settings: Settings{VAT: 1200, RoundTo: 1000},
+			lines:    []Line{{Price: 12345, Quantity: 1}},
+			want:     Breakdown{Subtotal: 12345, VATRate: 1200, VAT: 1481, Rounding: 174, Total: 14000},
+		},
+		{
+			name:     "half rounds up",
+			settings: Settings{VATIncluded: true, RoundTo: 1000},
+			lines:    []Line{{Price: 12500, Quantity: 1}},
+			want:     Breakdown{Subtotal: 12500, VATIncluded: true, Rounding: 500, Total: 13000},
+		},
+		{
+			name:     "no lines",
+			settings: Settings{VAT: 1200, VATIncluded: true, RoundTo: 1000},
+			want:     Breakdown{VATRate: 1200, VATIncluded: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.settings.Price(tt.lines)
+			if err != nil {
+				t.Fatalf("Price: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Price = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceTooLarge(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []Line
+	}{
+		{"line overflows", []Line{{Price: math.MaxUint, Quantity: 2}}},
+		{"line above MaxAmount", []Line{{Price: MaxAmount, Quantity: 2}}},
+		{"subtotal above MaxAmount", []Line{{Price: MaxAmount, Quantity: 1}, {Price: 1, Quantity: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Current.Price(tt.lines); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Price error = %v, want ErrTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   uint
+		weights []uint64
+		step    uint
+		want    []uint
+	}{
+		{"equal with remainder", 100, []uint64{1, 1, 1}, 1, []uint{34, 33, 33}},
+		{"proportional", 1000, []uint64{1, 3}, 1, []uint{250, 750}},
+		{"all weights zero", 1000, []uint64{0, 0, 0, 0}, 1, []uint{250, 250, 250, 250}},
+		{"zero weight gets nothing", 900, []uint64{0, 1, 2}, 1, []uint{0, 300, 600}},
+		{"steps of 100", 10000, []uint64{1, 1, 1}, 100, []uint{3400, 3300, 3300}},
+		{"total not a multiple of the step", 10050, []uint64{1, 1}, 100, []uint{5050, 5000}},
+		{"largest remainder wins the step", 1000, []uint64{1, 2}, 1000, []uint{0, 1000}},
+		{"zero total", 0, []uint64{1, 2}, 1, []uint{0, 0}},
+		{"no parts", 500, nil, 1, []uint{}},
+		{"step zero means one", 10, []uint64{1, 1, 1}, 0, []uint{4, 3, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Allocate(tt.total, tt.weights, tt.step)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Allocate(%d, %v, %d) = %v, want %v", tt.total, tt.weights, tt.step, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateSumsToTotal(t *testing.T) {
+	weightSets := [][]uint64{
+		{1},
+		{1, 1},
+		{0, 0, 0},
+		{1, 2, 3, 4, 5, 6, 7},
+		{999, 1, 1},
+		{12345, 67890, 13579},
+		{MaxAmount, MaxAmount, 1},
+	}
+	for _, step := range Roundings {
+		for _, total := range []uint{0, 1, 99, 101, 999, 1001, 123456, 9999999, MaxAmount} {
+			for _, weights := range weightSets {
+				parts := Allocate(total, weights, step)
+				var sum uint
+				uneven := 0
+				for _, part := range parts {
+					sum += part
+					if part%step != 0 {
+						uneven++
+					}
+				}
+				if sum != total {
+					t.Errorf("Allocate(%d, %v, %d) = %v, adds up to %d", total, weights, step, parts, sum)
+				}
+				if uneven > 1 {
+					t.Errorf("Allocate(%d, %v, %d) = %v, more than one part off the step", total, weights, step, parts)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type AttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore keeps failure counters per key, for example "login:admin" or
+// "ip:10.0.0.5". A missing key is returned as the zero AttemptState.
+type AttemptStore interface {
+	Get(key string) (AttemptState, error)
+	Set(key string, state AttemptState) error
+	Delete(key string) error
+	// Update replaces the state of key with what fn returns, without any
+	// other Update of the same key in between.
+	Update(key string, fn func(AttemptState) AttemptState) (AttemptState, error)
+}
+
+// MemoryAttemptStore forgets a key once it has been quiet and unlocked for
+// ttl, checked when the key is read and in a sweep of all keys at most once
+// per ttl, so logins that are tried once do not pile up.
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	states    map[string]AttemptState
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+// NewMemoryAttemptStore keeps keys for ttl, which must be at least the
+// longest Lockout of the limiters using the store.
+func NewMemoryAttemptStore(ttl time.Duration) *MemoryAttemptStore {
+	return &MemoryAttemptStore{states: make(map[string]AttemptState), ttl: ttl, lastSweep: time.Now()}
+}
+
+func (s *MemoryAttemptStore) stale(state AttemptState, now time.Time) bool {
+	return now.After(state.LockedUntil) && now.Sub(state.LastFailure) > s.ttl
+}
+
+// load returns the live state of key. Callers hold s.mu.
+func (s *MemoryAttemptStore) load(key string) AttemptState {
+	now := time.Now()
+	if now.Sub(s.lastSweep) > s.ttl {
+		for k, state := range s.states {
+			if s.stale(state, now) {
+				delete(s.states, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	state, ok := s.states[key]
+	if ok && s.stale(state, now) {
+		delete(s.states, key)
+		return AttemptState{}
+	}
+	return state
+}
+
+func (s *MemoryAttemptStore) Get(key string) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(key), nil
+}
+
+func (s *MemoryAttemptStore) Set(key string, state AttemptState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[key] = state
+	return nil
+}
+
+func (s *MemoryAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+func (s *MemoryAttemptStore) Update(key string, fn func(AttemptState) AttemptState) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := fn(s.load(key))
+	if state.Failures == 0 && state.LockedUntil.IsZero() {
+		delete(s.states, key)
+	} else {
+		s.states[key] = state
+	}
+	return state, nil
+}
+
+type LimiterPolicy struct {
+	MaxFailures int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lockout     time.Duration
+}
+
+// LimiterPolicyFromEnv reads <prefix>_MAX_FAILURES, <prefix>_BACKOFF_BASE,
+// <prefix>_BACKOFF_MAX and <prefix>_LOCKOUT on top of the given defaults.
+func LimiterPolicyFromEnv(prefix string, defaults LimiterPolicy) (LimiterPolicy, error) {
+	policy := defaults
+	if raw := GetEnv(prefix + "_MAX_FAILURES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return policy, fmt.Errorf("%s_MAX_FAILURES must be a positive number", prefix)
+		}
+		policy.MaxFailures = n
+	}
+	var err error
+	if policy.BaseDelay, err = durationEnv(prefix+"_BACKOFF_BASE", defaults.BaseDelay); err != nil {
+		return policy, err
+	}
+	if policy.MaxDelay, err = durationEnv(prefix+"_BACKOFF_MAX", defaults.MaxDelay); err != nil {
+		return policy, err
+	}
+	if policy.Lockout, err = durationEnv(prefix+"_LOCKOUT", defaults.Lockout); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// Limiter slows down repeated failures for a key with an exponential delay
+// and locks the key once MaxFailures is reached. Counters are forgotten after
+// a quiet period as long as the lockout.
+type Limiter struct {
+	mu     sync.Mutex
+	store  AttemptStore
+	policy LimiterPolicy
+}
+
+func NewLimiter(store AttemptStore, policy LimiterPolicy) *Limiter {
+	return &Limiter{store: store, policy: policy}
+}
+
+func (l *Limiter) current(key string, now time.Time) (AttemptState, error) {
+	state, err := l.store.Get(key)
+	if err != nil {
+		return state, err
+	}
+	if l.expired(state, now) {
+		return AttemptState{}, nil
+	}
+	return state, nil
+}
+
+// wait returns how long a key in state has to wait before the next attempt.
+func (l *Limiter) wait(state AttemptState, now time.Time) time.Duration {
+	if state.Failures == 0 {
+		return 0
+	}
+	if now.Before(state.LockedUntil) {
+		return state.LockedUntil.Sub(now)
+	}
+	if state.Failures >= l.policy.MaxFailures {
+		return 0
+	}
+	delay := l.policy.BaseDelay << (state.Failures - 1)
+	if delay > l.policy.MaxDelay || delay <= 0 {
+		delay = l.policy.MaxDelay
+	}
+	return max(state.LastFailure.Add(delay).Sub(now), 0)
+}
+
+func (l *Limiter) expired(state AttemptState, now time.Time) bool {
+	return state.Failures > 0 && now.After(state.LockedUntil) && now.Sub(state.LastFailure) > l.policy.Lockout
+}
+
+// RetryAfter returns how long the key has to wait before the next attempt.
+func (l *Limiter) RetryAfter(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	state, err := l.current(key, now)
+	if err != nil {
+		return 0, err
+	}
+	return l.wait(state, now), nil
+}
+
+// Reserve counts an attempt as failed before it is made, so parallel
+// attempts cannot all slip in under the limit. It returns how long to wait
+// instead if the key may not try yet; nothing is counted then. A successful
+// attempt gives its reservation back with Release or Reset.
+func (l *Limiter) Reserve(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var wait time.Duration
+	_, err := l.store.Update(key, func(state AttemptState) AttemptState {
+		now := time.Now()
+		if l.expired(state, now) || (!state.LockedUntil.IsZero() && now.After(state.LockedUntil)) {
+			state = AttemptState{}
+		}
+		if wait = l.wait(state, now); wait > 0 {
+			return state
+		}
+		state.Failures++
+		state.LastFailure = now
+		if state.Failures >= l.policy.MaxFailures {
+			state.LockedUntil = now.Add(l.policy.Lockout)
+		}
+		return state
+	})
+	return wait, err
+}
+
+// Release gives back the attempt taken by Reserve.
+func (l *Limiter) Release(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.store.Update(key, func(state AttemptState) AttemptState {
+		if state.Failures > 0 {
+			state.Failures--
+		}
+		if state.Failures < l.policy.MaxFailures {
+			state.LockedUntil = time.Time{}
+		}
+		return state
+	})
+	return err
+}
+
+func (l *Limiter) Reset(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.store.Delete(key)
+}
+
+func (l *Limiter) State(key string) (AttemptState, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current(key, time.Now())
+}
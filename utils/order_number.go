@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderNumbering turns the per-business-day order sequence into the number
+// printed on tickets, such as "#0142".
+type OrderNumbering struct {
+	Prefix string
+	Format string
+	// DayStart is when a business day begins, so orders placed after
+	// midnight still belong to the evening they started in.
+	DayStart time.Duration
+}
+
+// NewOrderNumberingFromEnv reads:
+//
+//	ORDER_NUMBER_PREFIX  defaults to "#"; may be set to nothing
+//	ORDER_NUMBER_FORMAT  fmt verb for the sequence, defaults to "%04d"
+//	BUSINESS_DAY_START   time of day the business day begins, defaults to 04:00
+func NewOrderNumberingFromEnv() (*OrderNumbering, error) {
+	n := &OrderNumbering{Prefix: "#", Format: "%04d", DayStart: 4 * time.Hour}
+	if prefix, ok := os.LookupEnv("ORDER_NUMBER_PREFIX"); ok {
+		n.Prefix = prefix
+	}
+	if format := GetEnv("ORDER_NUMBER_FORMAT"); format != "" {
+		if strings.Count(format, "%") != 1 || strings.Contains(fmt.Sprintf(format, 1), "%!") {
+			return nil, fmt.Errorf("ORDER_NUMBER_FORMAT must contain exactly one integer verb such as %%04d, got %q", format)
+		}
+		n.Format = format
+	}
+	if start := GetEnv("BUSINESS_DAY_START"); start != "" {
+		t, err := time.Parse("15:04", start)
+		if err != nil {
+			return nil, fmt.Errorf("BUSINESS_DAY_START must look like 04:00, got %q", start)
+		}
+		n.DayStart = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return n, nil
+}
+
+// BusinessDay returns midnight, in UTC, of the business day t falls in.
+func (n *OrderNumbering) BusinessDay(t time.Time) time.Time {
+	shifted := t.Add(-n.DayStart)
+	return time.Date(shifted.Year(), shifted.Month(), shifted.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (n *OrderNumbering) Number(sequence int) string {
+	return n.Prefix + fmt.Sprintf(n.Format, sequence)
+}
+
+// Sequence reads the sequence back from a number as typed by a person: the
+// prefix and leading zeros are optional.
+func (n *OrderNumbering) Sequence(number string) (int, error) {
+	number = strings.TrimSpace(number)
+	number = strings.TrimPrefix(number, n.Prefix)
+	number = strings.TrimPrefix(number, "#")
+	sequence, err := strconv.Atoi(number)
+	if err != nil || sequence < 1 {
+		return 0, fmt.Errorf("%q is not an order number", number)
+	}
+	return sequence, nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// bcrypt ignores everything after the first 72 bytes.
+const maxPasswordLength = 72
+
+var commonPasswords = []string{
+	"123456", "1234567", "12345678", "123456789", "1234567890", "0987654321",
+	"111111", "11111111", "000000", "00000000", "123123", "123321", "654321",
+	"password", "password1", "password123", "passw0rd", "qwerty", "qwerty123",
+	"qwertyuiop", "1q2w3e4r", "1q2w3e4r5t", "abc123", "abcd1234", "admin",
+	"admin123", "administrator", "letmein", "welcome", "iloveyou", "monkey",
+	"dragon", "football", "baseball", "sunshine", "princess", "master",
+	"restaurant", "restoran", "parol", "parol123", "uzbekistan", "tashkent",
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	denylist  map[string]struct{}
+}
+
+var Passwords *PasswordPolicy
+
+func InitPasswordPolicy() error {
+	policy, err := NewPasswordPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	Passwords = policy
+	return nil
+}
+
+// NewPasswordPolicyFromEnv reads:
+//
+//	PASSWORD_MIN_LENGTH     defaults to 8
+//	PASSWORD_DENYLIST_FILE  optional file with one forbidden password per
+//	                        line, added to the built-in list
+func NewPasswordPolicyFromEnv() (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{MinLength: 8, denylist: map[string]struct{}{}}
+	if value := GetEnv("PASSWORD_MIN_LENGTH"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPasswordLength {
+			return nil, fmt.Errorf("PASSWORD_MIN_LENGTH must be between 1 and %d, got %q", maxPasswordLength, value)
+		}
+		policy.MinLength = n
+	}
+	policy.Deny(commonPasswords...)
+	if path := GetEnv("PASSWORD_DENYLIST_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("PASSWORD_DENYLIST_FILE: %w", err)
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			policy.Deny(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("PASSWORD_DENYLIST_FILE: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+func (p *PasswordPolicy) Deny(passwords ...string) {
+	for _, password := range passwords {
+		if password = strings.ToLower(strings.TrimSpace(password)); password != "" {
+			p.denylist[password] = struct{}{}
+		}
+	}
+}
+
+// Check returns a message suitable for the API client when password is not
+// acceptable for the account with the given login.
+func (p *PasswordPolicy) Check(password, login string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes long", maxPasswordLength)
+	}
+	lower := strings.ToLower(password)
+	if login != "" && lower == strings.ToLower(login) {
+		return errors.New("password must not match the login")
+	}
+	if _, denied := p.denylist[lower]; denied {
+		return errors.New("password is too common")
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	minKeyLength  = 32
+	guestAudience = "guest"
+)
+
+var errGuestToken = errors.New("guest tokens cannot be used here")
+
+type Claims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// GuestClaims identify the table session of a guest who scanned the QR code
+// of a table. They carry the "guest" audience so they are never accepted as
+// staff tokens.
+type GuestClaims struct {
+	TableID        string `json:"table_id"`
+	TableSessionID string `json:"tsid"`
+	jwt.RegisteredClaims
+}
+
+// TokenService signs tokens with the active key and verifies them with any
+// configured key, so a secret can be rotated by adding the new key, making it
+// active and removing the old one once its tokens have expired.
+type TokenService struct {
+	issuer     string
+	activeKID  string
+	keys       map[string][]byte
+	ttl        time.Duration
+	refreshTTL time.Duration
+	maxAge     time.Duration
+	guestTTL   time.Duration
+	leeway     time.Duration
+}
+
+var Tokens *TokenService
+
+func InitTokens() error {
+	service, err := NewTokenServiceFromEnv()
+	if err != nil {
+		return err
+	}
+	Tokens = service
+	return nil
+}
+
+// NewTokenServiceFromEnv reads:
+//
+//	JWT_KEYS        comma separated kid:secret pairs
+//	JWT_ACTIVE_KID  kid used for signing, defaults to the first key
+//	JWT_ISSUER      defaults to "m-menu"
+//	JWT_TTL         access token lifetime, defaults to 15m
+//	JWT_REFRESH_TTL refresh token lifetime, defaults to 720h
+//	JWT_SESSION_MAX_AGE how long refreshing keeps a login alive, defaults to 2160h
+//	GUEST_TOKEN_TTL guest table token lifetime, defaults to 12h
+func NewTokenServiceFromEnv() (*TokenService, error) {
+	keys, order, err := parseKeys(GetEnv("JWT_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	activeKID := GetEnv("JWT_ACTIVE_KID")
+	if activeKID == "" {
+		activeKID = order[0]
+	}
+	if _, ok := keys[activeKID]; !ok {
+		return nil, fmt.Errorf("JWT_ACTIVE_KID %q is not listed in JWT_KEYS", activeKID)
+	}
+	issuer := GetEnv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "m-menu"
+	}
+	ttl, err := durationEnv("JWT_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	refreshTTL, err := durationEnv("JWT_REFRESH_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	maxAge, err := durationEnv("JWT_SESSION_MAX_AGE", 90*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if maxAge < refreshTTL {
+		return nil, errors.New("JWT_SESSION_MAX_AGE must not be shorter than JWT_REFRESH_TTL")
+	}
+	guestTTL, err := durationEnv("GUEST_TOKEN_TTL", 12*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenService{
+		issuer:     issuer,
+		activeKID:  activeKID,
+		keys:       keys,
+		ttl:        ttl,
+		refreshTTL: refreshTTL,
+		maxAge:     maxAge,
+		guestTTL:   guestTTL,
+		leeway:     30 * time.Second,
+	}, nil
+}
+
+func parseKeys(raw string) (map[string][]byte, []string, error) {
+	keys := map[string][]byte{}
+	var order []string
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" {
+			return nil, nil, fmt.Errorf("JWT_KEYS entry %q must look like kid:secret", pair)
+		}
+		if len(secret) < minKeyLength {
+			return nil, nil, fmt.Errorf("JWT key %q must be at least %d bytes long", kid, minKeyLength)
+		}
+		if _, exists := keys[kid]; exists {
+			return nil, nil, fmt.Errorf("JWT key %q is listed twice", kid)
+		}
+		keys[kid] = []byte(secret)
+		order = append(order, kid)
+	}
+	if len(order) == 0 {
+		return nil, nil, errors.New("JWT_KEYS is empty")
+	}
+	return keys, order, nil
+}
+
+func durationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	raw := GetEnv(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
+
+func (s *TokenService) TTL() time.Duration {
+	return s.ttl
+}
+
+func (s *TokenService) RefreshTTL() time.Duration {
+	return s.refreshTTL
+}
+
+// SessionMaxAge bounds a session from its login, however often its refresh
+// token is rotated.
+func (s *TokenService) SessionMaxAge() time.Duration {
+	return s.maxAge
+}
+
+func (s *TokenService) GuestTTL() time.Duration {
+	return s.guestTTL
+}
+
+// Sign fills in the issuer, issue time and, unless already set, the expiry
+// before signing the claims with the active key.
+func (s *TokenService) Sign(claims *Claims) (string, error) {
+	s.stamp(&claims.RegisteredClaims, s.ttl)
+	return s.sign(claims)
+}
+
+// SignGuest is Sign for guest table tokens.
+func (s *TokenService) SignGuest(claims *GuestClaims) (string, error) {
+	s.stamp(&claims.RegisteredClaims, s.guestTTL)
+	claims.Audience = jwt.ClaimStrings{guestAudience}
+	return s.sign(claims)
+}
+
+func (s *TokenService) stamp(claims *jwt.RegisteredClaims, ttl time.Duration) {
+	now := time.Now()
+	claims.Issuer = s.issuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	}
+}
+
+func (s *TokenService) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = s.activeKID
+	return token.SignedString(s.keys[s.activeKID])
+}
+
+// Parse verifies the signature, the kid, exp, iat and the issuer. A leading
+// "Bearer " is ignored. Guest tokens are rejected.
+func (s *TokenService) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := s.parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if len(claims.Audience) > 0 {
+		return nil, errGuestToken
+	}
+	return claims, nil
+}
+
+// ParseGuest is Parse for tokens signed with SignGuest.
+func (s *TokenService) ParseGuest(tokenString string) (*GuestClaims, error) {
+	claims := &GuestClaims{}
+	if err := s.parse(tokenString, claims, jwt.WithAudience(guestAudience)); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *TokenService) parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+	opts = append([]jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(s.leeway),
+	}, opts...)
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key, nil
+	}, opts...)
+	return err
+}
+
+// RandomToken returns a URL-safe random string for opaque tokens such as
+// refresh tokens. Only its HashToken value should be stored.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,9 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,18 +20,6 @@ func CheckPassword(hashedPass string, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPass), []byte(password))
 }
 
-func CreateToken(user_id string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"user_id": user_id,
-			"exp":     time.Now().Add(time.Hour * 24).Unix(),
-		})
-	tokenString, err := token.SignedString([]byte("your_secret_key"))
-	if err != nil {
-		return "", err
-	}
-	return tokenString, nil
-}
 func RespondWithError(w http.ResponseWriter, statusCode int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -44,6 +30,14 @@ func RespondWithError(w http.ResponseWriter, statusCode int, message string, dat
 	})
 }
 
+// RespondWithRaw writes a JSON body that was encoded earlier, such as a
+// stored response replayed for a retried request.
+func RespondWithRaw(w http.ResponseWriter, statusCode int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
 func RespondWithSuccess(w http.ResponseWriter, statusCode int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -64,7 +58,3 @@ type WebSocketMessage struct {
 	Event string      `json:"event"`
 	Data  interface{} `json:"data"`
 }
-
-type OrderPayload struct {
-	Status string `json:"status" validate:"required"`
-}
@@ -6,10 +6,15 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// Client is one socket. SessionID is the staff or table session its ticket
+// was issued for, Kind says which; the socket is closed when that session
+// ends.
 type Client struct {
-	Conn   *websocket.Conn
-	UserID string
-	Rooms  map[string]bool
+	Conn      *websocket.Conn
+	UserID    string
+	SessionID string
+	Kind      string
+	Rooms     map[string]bool
 }
 
 type Hub struct {
@@ -25,6 +30,24 @@ func NewHub() *Hub {
 	}
 }
 
+func (h *Hub) Register(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.Clients[client] = true
+}
+func (h *Hub) Unregister(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.Clients, client)
+	for roomID := range client.Rooms {
+		delete(h.Rooms[roomID], client)
+		if len(h.Rooms[roomID]) == 0 {
+			delete(h.Rooms, roomID)
+		}
+	}
+}
 func (h *Hub) JoinRoom(client *Client, roomID string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -43,6 +66,33 @@ func (h *Hub) BroadcastToRoom(roomID string, message WebSocketMessage) {
 		client.Conn.WriteJSON(message)
 	}
 }
+
+// CloseRoom disconnects every client in the room. Their read loops notice
+// and unregister them.
+func (h *Hub) CloseRoom(roomID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.Rooms[roomID] {
+		client.Conn.Close()
+	}
+}
+
+// SessionIDs returns the sessions of the connected clients of a ticket kind.
+func (h *Hub) SessionIDs(kind string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen := map[string]bool{}
+	var ids []string
+	for client := range h.Clients {
+		if client.Kind == kind && !seen[client.SessionID] {
+			seen[client.SessionID] = true
+			ids = append(ids, client.SessionID)
+		}
+	}
+	return ids
+}
 func (h *Hub) BroadcastToAll(message WebSocketMessage) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
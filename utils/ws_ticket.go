@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	TicketUser         = "user"
+	TicketTableSession = "table_session"
+)
+
+// TicketSubject is what a WebSocket connection opened with the ticket may
+// listen to: the rooms of one user and their staff session, or the room of
+// one table session. SessionID is the staff or table session the connection
+// lives as long as.
+type TicketSubject struct {
+	Kind      string
+	UserID    string
+	SessionID string
+}
+
+type ticket struct {
+	subject   TicketSubject
+	expiresAt time.Time
+}
+
+// TicketStore keeps single-use WebSocket connection tickets in memory. The
+// tickets live for seconds, so losing them on restart only makes clients ask
+// for a new one.
+type TicketStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	tickets map[string]ticket
+}
+
+func NewTicketStore(ttl time.Duration) *TicketStore {
+	return &TicketStore{ttl: ttl, tickets: map[string]ticket{}}
+}
+
+// NewTicketStoreFromEnv reads WS_TICKET_TTL, which defaults to 30s.
+func NewTicketStoreFromEnv() (*TicketStore, error) {
+	ttl, err := durationEnv("WS_TICKET_TTL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return NewTicketStore(ttl), nil
+}
+
+func (s *TicketStore) TTL() time.Duration {
+	return s.ttl
+}
+
+func (s *TicketStore) Issue(subject TicketSubject) (string, error) {
+	value, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, t := range s.tickets {
+		if now.After(t.expiresAt) {
+			delete(s.tickets, key)
+		}
+	}
+	s.tickets[HashToken(value)] = ticket{subject: subject, expiresAt: now.Add(s.ttl)}
+	return value, nil
+}
+
+// Redeem returns the subject of the ticket and forgets it, so a ticket opens
+// at most one connection.
+func (s *TicketStore) Redeem(value string) (TicketSubject, bool) {
+	if value == "" {
+		return TicketSubject{}, false
+	}
+	key := HashToken(value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tickets[key]
+	if !ok {
+		return TicketSubject{}, false
+	}
+	delete(s.tickets, key)
+	if time.Now().After(t.expiresAt) {
+		return TicketSubject{}, false
+	}
+	return t.subject, true
+}
@@ -0,0 +1,176 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"gorm.io/gorm"
+)
+
+type auditChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// auditDiff compares the JSON forms of before and after field by field. Pass
+// nil as before for a create and nil as after for a delete.
+func auditDiff(before, after any) (models.JSON, error) {
+	toMap := func(v any) (map[string]any, error) {
+		m := map[string]any{}
+		if v == nil {
+			return m, nil
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return m, json.Unmarshal(raw, &m)
+	}
+	from, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+	diff := map[string]auditChange{}
+	for key, value := range from {
+		if key == "updated" {
+			continue
+		}
+		if !reflect.DeepEqual(value, to[key]) {
+			diff[key] = auditChange{From: value, To: to[key]}
+		}
+	}
+	for key, value := range to {
+		if _, seen := from[key]; !seen && key != "updated" {
+			diff[key] = auditChange{From: nil, To: value}
+		}
+	}
+	return json.Marshal(diff)
+}
+
+// audit writes an audit entry with tx, so it is committed or rolled back
+// together with the change it describes.
+func audit(tx *gorm.DB, r *http.Request, action, entityType, entityID string, before, after any) error {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	entry := models.AuditLog{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Diff:       diff,
+		IP:         utils.ClientIP(r),
+	}
+	if actorID, ok := r.Context().Value(middleware.UserIDKey).(string); ok {
+		entry.ActorID = &actorID
+	}
+	return tx.Create(&entry).Error
+}
+
+func auditQuery(r *http.Request) *gorm.DB {
+	query := r.URL.Query()
+	db := models.DB.Model(&models.AuditLog{})
+	if actorID := query.Get("actor_id"); actorID != "" {
+		db = db.Where("actor_id = ?", actorID)
+	}
+	if action := query.Get("action"); action != "" {
+		db = db.Where("action = ?", action)
+	}
+	if entityType := query.Get("entity_type"); entityType != "" {
+		db = db.Where("entity_type = ?", entityType)
+	}
+	if entityID := query.Get("entity_id"); entityID != "" {
+		db = db.Where("entity_id = ?", entityID)
+	}
+	if from, err := time.Parse(time.DateOnly, query.Get("from")); err == nil {
+		db = db.Where("created_at >= ?", from)
+	}
+	if to, err := time.Parse(time.DateOnly, query.Get("to")); err == nil {
+		db = db.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+	return db
+}
+
+func GetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	var total int64
+	if dbResult := auditQuery(r).Count(&total); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	var entries []models.AuditLog
+	if dbResult := auditQuery(r).
+		Preload("Actor").
+		Order("created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&entries); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.AuditPage{
+		Items: dto.NewAuditLogList(entries),
+		Page:  page,
+		Limit: limit,
+		Total: total,
+	})
+}
+func DownloadAuditExcel(w http.ResponseWriter, r *http.Request) {
+	var entries []models.AuditLog
+	if err := auditQuery(r).Preload("Actor").Order("created_at DESC").Find(&entries).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch data", err.Error())
+		return
+	}
+
+	exporter := utils.NewTaomExcelExporter()
+	headers := []string{"Vaqt", "Xodim", "Amal", "Obyekt turi", "Obyekt ID", "O'zgarishlar", "IP"}
+	exporter.SetHeaders(headers)
+
+	var rows [][]any
+	for _, e := range entries {
+		actor := ""
+		if e.Actor != nil {
+			actor = e.Actor.Login
+		}
+		rows = append(rows, []any{
+			e.CreatedAt.Format("2006-01-02 15:04"),
+			actor,
+			e.Action,
+			e.EntityType,
+			e.EntityID,
+			string(e.Diff),
+			e.IP,
+		})
+	}
+	exporter.SetRows(rows)
+
+	buf, err := exporter.Generate()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate Excel file", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit_log.xlsx"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,318 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/payments"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxCommonDenominator bounds the common denominator of the shares of one
+// line. Denominators up to 100 could otherwise need one beyond uint64.
+const maxCommonDenominator = 1_000_000
+
+// splitOrders locks the orders to split, with their lines, and checks that
+// they are on one table and neither split nor paid already.
+func splitOrders(tx *gorm.DB, input dto.BillSplitInput) ([]models.Order, error) {
+	var orders []models.Order
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("created_at")
+	if input.OrderID != "" {
+		query = query.Where("id = ?", input.OrderID)
+	} else {
+		openSessions := tx.Model(&models.TableSession{}).Select("id").Where("table_id = ? AND closed_at IS NULL", input.TableID)
+		query = query.Where("table_session_id IN (?) AND status NOT IN ?", openSessions,
+			[]models.OrderStatus{models.OrderCancelled, models.OrderRejected, models.OrderPaid})
+	}
+	if err := query.Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, &orderError{http.StatusNotFound, "Nothing to split", "No open orders were found"}
+	}
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+		switch order.Status {
+		case models.OrderPending:
+			return nil, &orderError{http.StatusConflict, "Order is still pending", fmt.Sprintf("Accept or cancel order %s before splitting", order.OrderId)}
+		case models.OrderCancelled, models.OrderRejected, models.OrderPaid:
+			return nil, &orderError{http.StatusConflict, "Order cannot be split", fmt.Sprintf("The order is %s", order.Status)}
+		}
+		if order.TableID != orders[0].TableID {
+			return nil, &orderError{http.StatusConflict, "Orders are on different tables", "Only orders of one table can be split together"}
+		}
+		splitID, err := models.ActiveSplitOf(tx, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		if splitID != "" {
+			return nil, &orderError{http.StatusConflict, "Order is already split", fmt.Sprintf("Cancel split %s first", splitID)}
+		}
+		confirmed, pending, err := models.PaidAmounts(tx, models.Payment{OrderID: &orders[i].ID})
+		if err != nil {
+			return nil, err
+		}
+		if confirmed+pending > 0 {
+			return nil, &orderError{http.StatusConflict, "Order is partly paid", fmt.Sprintf("Order %s already has payments", order.OrderId)}
+		}
+	}
+	var lines []models.OrderFood
+	if err := tx.Where("order_id IN ?", ids).Order("created_at").Find(&lines).Error; err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		for _, line := range lines {
+			if line.OrderID == orders[i].ID {
+				orders[i].OrderFood = append(orders[i].OrderFood, line)
+			}
+		}
+	}
+	return orders, nil
+}
+
+// splitBills divides the orders into bills. Every line is divided between
+// the bills sharing it, then the orders' total, with service charge, VAT
+// and rounding, is divided in proportion to what each bill got, so the
+// bills add up to the total exactly.
+func splitBills(input dto.BillSplitInput, orders []models.Order) ([]models.Bill, error) {
+	var subtotal, total uint
+	for _, order := range orders {
+		subtotal += order.Subtotal
+		total += order.Total
+	}
+	if input.Mode == models.SplitEqual {
+		if input.Parts == 0 {
+			return nil, &orderError{http.StatusBadRequest, "Invalid request payload", "Parts is required for an equal split"}
+		}
+		equal := slices.Repeat([]uint64{1}, input.Parts)
+		subtotals := pricing.Allocate(subtotal, equal, 1)
+		amounts := pricing.Allocate(total, equal, pricing.Current.RoundTo)
+		bills := make([]models.Bill, input.Parts)
+		for i := range bills {
+			bills[i] = models.Bill{Label: fmt.Sprintf("%d/%d", i+1, input.Parts), Subtotal: subtotals[i], Amount: amounts[i]}
+		}
+		return bills, nil
+	}
+
+	if len(input.Bills) == 0 {
+		return nil, &orderError{http.StatusBadRequest, "Invalid request payload", "Bills are required for an items split"}
+	}
+	type share struct {
+		bill                   int
+		numerator, denominator uint
+	}
+	shares := map[string][]share{}
+	for _, order := range orders {
+		for _, line := range order.OrderFood {
+			shares[line.ID] = nil
+		}
+	}
+	for b, bill := range input.Bills {
+		for _, item := range bill.Items {
+			s := share{b, max(item.Numerator, 1), max(item.Denominator, 1)}
+			if s.numerator > s.denominator {
+				return nil, &orderError{http.StatusBadRequest, "Invalid share", fmt.Sprintf("%d/%d of a line is more than the line", s.numerator, s.denominator)}
+			}
+			if _, ok := shares[item.OrderFoodID]; !ok {
+				return nil, &orderError{http.StatusBadRequest, "Invalid line", fmt.Sprintf("Line %s is not part of the orders being split", item.OrderFoodID)}
+			}
+			shares[item.OrderFoodID] = append(shares[item.OrderFoodID], s)
+		}
+	}
+
+	bills := make([]models.Bill, len(input.Bills))
+	for b, bill := range input.Bills {
+		bills[b].Label = bill.Label
+	}
+	for _, order := range orders {
+		for _, line := range order.OrderFood {
+			lineShares := shares[line.ID]
+			if len(lineShares) == 0 {
+				return nil, &orderError{http.StatusBadRequest, "Line is not assigned", fmt.Sprintf("Line %s (%s) is on no bill", line.ID, line.NameEn)}
+			}
+			var common uint64 = 1
+			for _, s := range lineShares {
+				common = lcm(common, uint64(s.denominator))
+				if common > maxCommonDenominator {
+					return nil, &orderError{http.StatusBadRequest, "Line is split too finely", fmt.Sprintf("The shares of line %s (%s) need a common denominator above %d", line.ID, line.NameEn, maxCommonDenominator)}
+				}
+			}
+			weights := make([]uint64, len(lineShares))
+			var sum uint64
+			for i, s := range lineShares {
+				weights[i] = uint64(s.numerator) * (common / uint64(s.denominator))
+				sum += weights[i]
+			}
+			if sum != common {
+				return nil, &orderError{http.StatusBadRequest, "Line is not split exactly", fmt.Sprintf("The shares of line %s (%s) add up to %d/%d", line.ID, line.NameEn, sum, common)}
+			}
+			amount, err := pricing.Line{Price: line.Price, Quantity: line.Quantity}.Amount()
+			if err != nil {
+				return nil, err
+			}
+			amounts := pricing.Allocate(amount, weights, 1)
+			for i, s := range lineShares {
+				bills[s.bill].Subtotal += amounts[i]
+				bills[s.bill].Lines = append(bills[s.bill].Lines, models.BillLine{
+					OrderFoodID: line.ID,
+					Numerator:   s.numerator,
+					Denominator: s.denominator,
+					Amount:      amounts[i],
+				})
+			}
+		}
+	}
+	weights := make([]uint64, len(bills))
+	for i, bill := range bills {
+		weights[i] = uint64(bill.Subtotal)
+	}
+	for i, amount := range pricing.Allocate(total, weights, pricing.Current.RoundTo) {
+		bills[i].Amount = amount
+	}
+	return bills, nil
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b uint64) uint64 {
+	return a / gcd(a, b) * b
+}
+
+func broadcastSplit(event string, split models.BillSplit, res dto.BillSplitResponse) {
+	message := utils.WebSocketMessage{Event: event, Data: res}
+	broadcastToGuests(message, split.Orders...)
+	HubInstance.BroadcastToRoom(staffRoom, message)
+}
+
+// CreateBillSplit splits one order, or all open orders of a table, into
+// bills that are paid through /v1/bill/{id}/payments.
+func CreateBillSplit(w http.ResponseWriter, r *http.Request) {
+	var input dto.BillSplitInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	actorID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	var split models.BillSplit
+	var res dto.BillSplitResponse
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		orders, err := splitOrders(tx, input)
+		if err != nil {
+			return err
+		}
+		bills, err := splitBills(input, orders)
+		if err != nil {
+			return err
+		}
+		split = models.BillSplit{TableID: orders[0].TableID, Mode: input.Mode, Orders: orders, Bills: bills, CreatedByID: &actorID}
+		for _, bill := range bills {
+			split.Total += bill.Amount
+		}
+		if err := tx.Omit("Orders.*").Create(&split).Error; err != nil {
+			return err
+		}
+		res = dto.NewBillSplit(split, nil)
+		return audit(tx, r, models.AuditCreate, "bill_split", split.ID, nil, res)
+	})
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to split the bill", err.Error())
+		return
+	}
+	broadcastSplit("bill_split", split, res)
+	utils.RespondWithSuccess(w, http.StatusCreated, "Bill split", res)
+}
+
+func loadBillSplit(db *gorm.DB, id string) (models.BillSplit, dto.BillSplitResponse, error) {
+	var split models.BillSplit
+	if err := db.Preload("Orders").Preload("Bills.Lines").First(&split, "ID = ?", id).Error; err != nil {
+		return split, dto.BillSplitResponse{}, err
+	}
+	billIDs := make([]string, len(split.Bills))
+	for i, bill := range split.Bills {
+		billIDs[i] = bill.ID
+	}
+	var list []models.Payment
+	if err := db.Where("bill_id IN ?", billIDs).Order("created_at").Find(&list).Error; err != nil {
+		return split, dto.BillSplitResponse{}, err
+	}
+	return split, dto.NewBillSplit(split, list), nil
+}
+
+func GetBillSplit(w http.ResponseWriter, r *http.Request) {
+	_, res, err := loadBillSplit(models.DB, mux.Vars(r)["id"])
+	if err != nil {
+		respondPaymentError(w, err, "get split")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", res)
+}
+
+// CancelBillSplit undoes a split no bill of which has been paid, so the
+// orders can be paid or split again.
+func CancelBillSplit(w http.ResponseWriter, r *http.Request) {
+	var split models.BillSplit
+	var res dto.BillSplitResponse
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&split, "ID = ?", mux.Vars(r)["id"]).Error; err != nil {
+			return err
+		}
+		if split.CancelledAt != nil {
+			return &orderError{http.StatusConflict, "Split is already cancelled", ""}
+		}
+		var count int64
+		err := tx.Model(&models.Payment{}).
+			Where("bill_id IN (?) AND status IN ?", tx.Model(&models.Bill{}).Select("id").Where("split_id = ?", split.ID),
+				[]payments.Status{payments.StatusConfirmed, payments.StatusPending}).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return &orderError{http.StatusConflict, "Split cannot be cancelled", "Some of its bills are paid or being paid"}
+		}
+		_, before, err := loadBillSplit(tx, split.ID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&split).Update("cancelled_at", now).Error; err != nil {
+			return err
+		}
+		if split, res, err = loadBillSplit(tx, split.ID); err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "bill_split", split.ID, before, res)
+	})
+	if err != nil {
+		respondPaymentError(w, err, "cancel split")
+		return
+	}
+	broadcastSplit("bill_split_cancelled", split, res)
+	utils.RespondWithSuccess(w, http.StatusOK, "Split cancelled", res)
+}
@@ -0,0 +1,232 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
+)
+
+// pricedOrder builds an order with the given lines, priced with the current
+// settings, the way PriceOrder would.
+func pricedOrder(t *testing.T, id string, lines ...models.OrderFood) models.Order {
+	t.Helper()
+	for i := range lines {
+		lines[i].ID = fmt.Sprintf("%s-%d", id, i)
+		lines[i].OrderID = id
+	}
+	breakdown, err := pricing.Current.Price(models.PricingLines(lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.Order{ID: id, OrderFood: lines, Breakdown: breakdown}
+}
+
+func withPricing(t *testing.T, settings pricing.Settings) {
+	t.Helper()
+	previous := pricing.Current
+	pricing.Current = settings
+	t.Cleanup(func() { pricing.Current = previous })
+}
+
+func share(line string, numerator, denominator uint) dto.BillShareInput {
+	return dto.BillShareInput{OrderFoodID: line, Numerator: numerator, Denominator: denominator}
+}
+
+// checkBills verifies that the bills add up to the orders exactly: amounts
+// to the total in steps of RoundTo, subtotals to the subtotal and each
+// line's shares to the line.
+func checkBills(t *testing.T, orders []models.Order, bills []models.Bill) {
+	t.Helper()
+	var subtotal, total uint
+	lineAmounts := map[string]uint{}
+	for _, order := range orders {
+		subtotal += order.Subtotal
+		total += order.Total
+		for _, line := range order.OrderFood {
+			lineAmounts[line.ID] = line.Price * line.Quantity
+		}
+	}
+	var billSubtotals, billAmounts uint
+	shared := map[string]uint{}
+	for _, bill := range bills {
+		billSubtotals += bill.Subtotal
+		billAmounts += bill.Amount
+		if bill.Amount%pricing.Current.RoundTo != 0 {
+			t.Errorf("bill %q amount %d is not a multiple of %d", bill.Label, bill.Amount, pricing.Current.RoundTo)
+		}
+		var lines uint
+		for _, line := range bill.Lines {
+			shared[line.OrderFoodID] += line.Amount
+			lines += line.Amount
+		}
+		if len(bill.Lines) > 0 && lines != bill.Subtotal {
+			t.Errorf("bill %q lines add up to %d, subtotal is %d", bill.Label, lines, bill.Subtotal)
+		}
+	}
+	if billAmounts != total {
+		t.Errorf("bill amounts add up to %d, want total %d", billAmounts, total)
+	}
+	if billSubtotals != subtotal {
+		t.Errorf("bill subtotals add up to %d, want subtotal %d", billSubtotals, subtotal)
+	}
+	for id, amount := range shared {
+		if amount != lineAmounts[id] {
+			t.Errorf("line %s shares add up to %d, want %d", id, amount, lineAmounts[id])
+		}
+	}
+}
+
+func TestSplitBillsRejectsInexactShares(t *testing.T) {
+	withPricing(t, pricing.Settings{VATIncluded: true, RoundTo: 1})
+	orders := []models.Order{pricedOrder(t, "a",
+		models.OrderFood{NameEn: "Plov", Price: 30000, Quantity: 1},
+		models.OrderFood{NameEn: "Tea", Price: 5000, Quantity: 1},
+	)}
+	tests := []struct {
+		name  string
+		bills []dto.BillInput
+	}{
+		{
+			name: "shares below one",
+			bills: []dto.BillInput{
+				{Items: []dto.BillShareInput{share("a-0", 1, 2), share("a-1", 1, 1)}},
+				{Items: []dto.BillShareInput{share("a-0", 1, 3)}},
+			},
+		},
+		{
+			name: "shares above one",
+			bills: []dto.BillInput{
+				{Items: []dto.BillShareInput{share("a-0", 1, 2), share("a-1", 1, 1)}},
+				{Items: []dto.BillShareInput{share("a-0", 2, 3)}},
+			},
+		},
+		{
+			name: "share larger than the line",
+			bills: []dto.BillInput{
+				{Items: []dto.BillShareInput{share("a-0", 3, 2), share("a-1", 1, 1)}},
+				{Items: []dto.BillShareInput{}},
+			},
+		},
+		{
+			name: "line on no bill",
+			bills: []dto.BillInput{
+				{Items: []dto.BillShareInput{share("a-0", 1, 2)}},
+				{Items: []dto.BillShareInput{share("a-0", 1, 2)}},
+			},
+		},
+		{
+			name: "line of another order",
+			bills: []dto.BillInput{
+				{Items: []dto.BillShareInput{share("a-0", 1, 1), share("a-1", 1, 1)}},
+				{Items: []dto.BillShareInput{share("b-0", 1, 1)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := splitBills(dto.BillSplitInput{Mode: models.SplitItems, Bills: tt.bills}, orders)
+			var refused *orderError
+			if !errors.As(err, &refused) || refused.status != http.StatusBadRequest {
+				t.Fatalf("splitBills error = %v, want a 400 orderError", err)
+			}
+		})
+	}
+}
+
+func TestSplitBillsRejectsHugeCommonDenominator(t *testing.T) {
+	withPricing(t, pricing.Settings{VATIncluded: true, RoundTo: 1})
+	orders := []models.Order{pricedOrder(t, "a", models.OrderFood{Price: 10000, Quantity: 1})}
+	// The primes below 100 multiply to more than fits in a uint64.
+	primes := []uint{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89, 97}
+	var first, second []dto.BillShareInput
+	for i, p := range primes {
+		if i%2 == 0 {
+			first = append(first, share("a-0", 1, p))
+		} else {
+			second = append(second, share("a-0", 1, p))
+		}
+	}
+	_, err := splitBills(dto.BillSplitInput{Mode: models.SplitItems, Bills: []dto.BillInput{{Items: first}, {Items: second}}}, orders)
+	var refused *orderError
+	if !errors.As(err, &refused) || refused.status != http.StatusBadRequest || refused.message != "Line is split too finely" {
+		t.Fatalf("splitBills error = %v, want a 400 for a line split too finely", err)
+	}
+}
+
+func TestSplitBillsMixedDenominators(t *testing.T) {
+	withPricing(t, pricing.Settings{VATIncluded: true, RoundTo: 1})
+	orders := []models.Order{pricedOrder(t, "a",
+		models.OrderFood{Price: 10000, Quantity: 1},
+		models.OrderFood{Price: 7000, Quantity: 1},
+	)}
+	input := dto.BillSplitInput{Mode: models.SplitItems, Bills: []dto.BillInput{
+		{Label: "half", Items: []dto.BillShareInput{share("a-0", 1, 2), share("a-1", 1, 4)}},
+		{Label: "third", Items: []dto.BillShareInput{share("a-0", 1, 3), share("a-1", 3, 4)}},
+		{Label: "sixth", Items: []dto.BillShareInput{share("a-0", 1, 6)}},
+	}}
+	bills, err := splitBills(input, orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBills(t, orders, bills)
+	want := []uint{5000 + 1750, 3333 + 5250, 1667}
+	for i, bill := range bills {
+		if bill.Subtotal != want[i] {
+			t.Errorf("bill %q subtotal = %d, want %d", bill.Label, bill.Subtotal, want[i])
+		}
+	}
+}
+
+func TestSplitBillsEqualWithRemainder(t *testing.T) {
+	withPricing(t, pricing.Settings{VATIncluded: true, RoundTo: 1})
+	orders := []models.Order{pricedOrder(t, "a", models.OrderFood{Price: 10000, Quantity: 1})}
+	bills, err := splitBills(dto.BillSplitInput{Mode: models.SplitEqual, Parts: 3}, orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBills(t, orders, bills)
+	for i, want := range []uint{3334, 3333, 3333} {
+		if bills[i].Amount != want {
+			t.Errorf("bill %d amount = %d, want %d", i, bills[i].Amount, want)
+		}
+	}
+	if _, err := splitBills(dto.BillSplitInput{Mode: models.SplitEqual}, orders); err == nil {
+		t.Error("equal split without parts was accepted")
+	}
+}
+
+func TestSplitBillsAddUpUnderRounding(t *testing.T) {
+	for _, roundTo := range []uint{100, 1000} {
+		t.Run(fmt.Sprint(roundTo), func(t *testing.T) {
+			withPricing(t, pricing.Settings{ServiceCharge: 1000, VAT: 1200, RoundTo: roundTo})
+			orders := []models.Order{
+				pricedOrder(t, "a",
+					models.OrderFood{Price: 23450, Quantity: 3},
+					models.OrderFood{Price: 4990, Quantity: 1},
+				),
+				pricedOrder(t, "b", models.OrderFood{Price: 17777, Quantity: 2}),
+			}
+			for parts := 2; parts <= 7; parts++ {
+				bills, err := splitBills(dto.BillSplitInput{Mode: models.SplitEqual, Parts: parts}, orders)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkBills(t, orders, bills)
+			}
+			bills, err := splitBills(dto.BillSplitInput{Mode: models.SplitItems, Bills: []dto.BillInput{
+				{Label: "1", Items: []dto.BillShareInput{share("a-0", 1, 3), share("b-0", 1, 1)}},
+				{Label: "2", Items: []dto.BillShareInput{share("a-0", 1, 3), share("a-1", 1, 2)}},
+				{Label: "3", Items: []dto.BillShareInput{share("a-0", 1, 3), share("a-1", 1, 2)}},
+			}}, orders)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkBills(t, orders, bills)
+		})
+	}
+}
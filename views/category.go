@@ -4,24 +4,34 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
 	"github.com/davronkhamdamov/restaraunt_backend/models"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 func CreateCategory(w http.ResponseWriter, r *http.Request) {
-	category := models.Category{}
-	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+	input := dto.CategoryInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(category); err != nil {
+	if err := validate.Struct(input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
+	category := models.Category{}
+	input.Apply(&category)
 
-	if dbResult := models.DB.Create(&category); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create category", dbResult.Error.Error())
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "category", category.ID, nil, dto.NewCategory(category))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create category", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusCreated, "Category created successfully", nil)
@@ -46,7 +56,7 @@ func GetCategory(w http.ResponseWriter, r *http.Request) {
 		category.Name = category.NameUz
 	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", category)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewCategory(category))
 }
 func GetAllCategory(w http.ResponseWriter, r *http.Request) {
 	categories := []models.Category{}
@@ -67,7 +77,7 @@ func GetAllCategory(w http.ResponseWriter, r *http.Request) {
 			categories[i].Name = categories[i].NameUz
 		}
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", categories)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewCategoryList(categories))
 }
 func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	category := models.Category{}
@@ -77,16 +87,25 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusNotFound, "Category not found", dbResult.Error.Error())
 		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	input := dto.CategoryInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(category); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if dbResult := models.DB.Save(&category); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	before := dto.NewCategory(category)
+	input.Apply(&category)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&category).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "category", category.ID, before, dto.NewCategory(category))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusOK, "Category updated successfully", nil)
@@ -99,8 +118,14 @@ func DeleteCategory(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusNotFound, "Category not found", dbResult.Error.Error())
 		return
 	}
-	if dbResult := models.DB.Delete(&category); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&category).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditDelete, "category", category.ID, dto.NewCategory(category), nil)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
 
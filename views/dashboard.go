@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
 )
 
@@ -31,7 +32,7 @@ func GetDashboard(w http.ResponseWriter, r *http.Request) {
 		categoriesCount int64
 		foodsCount      int64
 		feedbacksCount  int64
-		todayRevenue    int64
+		todayOrders     []models.Order
 		ordersThisWeek  []models.Order
 	)
 
@@ -41,20 +42,23 @@ func GetDashboard(w http.ResponseWriter, r *http.Request) {
 	startOfWeek := now.AddDate(0, 0, -6)
 
 	models.DB.Model(&models.Order{}).
-		Where("created_at >= ? AND created_at < ? AND user_id IS NOT NULL AND status = 'done'", startOfDay, endOfDay).
+		Where("created_at >= ? AND created_at < ? AND user_id IS NOT NULL AND status IN ?", startOfDay, endOfDay, models.CompletedOrderStatuses).
 		Count(&ordersCount)
 
-	models.DB.Model(&models.Order{}).
-		Select("COALESCE(SUM(total), 0)").
-		Where("created_at >= ? AND created_at < ? AND user_id IS NOT NULL AND status = 'done'", startOfDay, endOfDay).
-		Scan(&todayRevenue)
+	models.DB.Where("created_at >= ? AND created_at < ? AND user_id IS NOT NULL AND status IN ?", startOfDay, endOfDay, models.CompletedOrderStatuses).
+		Find(&todayOrders)
+	todayBreakdowns := make([]pricing.Breakdown, len(todayOrders))
+	for i, order := range todayOrders {
+		todayBreakdowns[i] = order.Breakdown
+	}
+	todayTotals := pricing.Sum(todayBreakdowns...)
 
 	models.DB.Model(&models.Feedback{}).Count(&feedbacksCount)
 	models.DB.Model(&models.Table{}).Count(&tablesCount)
 	models.DB.Model(&models.Category{}).Count(&categoriesCount)
 	models.DB.Model(&models.Food{}).Count(&foodsCount)
 
-	models.DB.Where("created_at BETWEEN ? AND ? AND user_id IS NOT NULL AND status = 'done'", startOfWeek, endOfDay).Find(&ordersThisWeek)
+	models.DB.Where("created_at BETWEEN ? AND ? AND user_id IS NOT NULL AND status IN ?", startOfWeek, endOfDay, models.CompletedOrderStatuses).Find(&ordersThisWeek)
 
 	dailyTotals := make(map[string]uint)
 	for _, order := range ordersThisWeek {
@@ -77,7 +81,8 @@ func GetDashboard(w http.ResponseWriter, r *http.Request) {
 		"total_tables":     tablesCount,
 		"total_categories": categoriesCount,
 		"total_foods":      foodsCount,
-		"today_revenue":    todayRevenue,
+		"today_revenue":    todayTotals.Total,
+		"today_breakdown":  todayTotals,
 		"one_week_report":  oneWeekReport,
 	}
 	utils.RespondWithSuccess(w, http.StatusOK, "OK", response)
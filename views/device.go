@@ -0,0 +1,171 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func CreateDevice(w http.ResponseWriter, r *http.Request) {
+	input := dto.DeviceInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	token, err := utils.RandomToken()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	device := models.Device{Name: input.Name, TokenHash: utils.HashToken(token)}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&device).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "device", device.ID, nil, dto.NewDevice(device))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to register device", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusCreated, "Device registered successfully", dto.RegisteredDeviceResponse{
+		DeviceResponse: dto.NewDevice(device),
+		Token:          token,
+	})
+}
+func GetDevices(w http.ResponseWriter, r *http.Request) {
+	var devices []models.Device
+	if dbResult := models.DB.Order("created_at DESC").Find(&devices); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewDeviceList(devices))
+}
+
+// RevokeDevice deactivates the tablet and ends every PIN session opened on it.
+func RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var device models.Device
+	if dbResult := models.DB.Where("ID = ?", vars["id"]).First(&device); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Device not found", dbResult.Error.Error())
+		return
+	}
+	before := dto.NewDevice(device)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&device).Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Session{}).
+			Where("device_id = ? AND revoked_at IS NULL", device.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "device", device.ID, before, dto.NewDevice(device))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	closeEndedSessions()
+	utils.RespondWithSuccess(w, http.StatusOK, "Device revoked successfully", nil)
+}
+func GetDeviceStaff(w http.ResponseWriter, r *http.Request) {
+	var staff []models.User
+	if dbResult := models.DB.Where("active AND pin_hash <> ''").Order("display_name, login").Find(&staff); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewDeviceStaffList(staff))
+}
+
+// PinLogin switches a shared tablet to another user. The token it returns is
+// short-lived, cannot be refreshed and only works together with the device
+// token. Any previous PIN session on the same tablet is closed.
+func PinLogin(w http.ResponseWriter, r *http.Request) {
+	deviceID, _ := r.Context().Value(middleware.DeviceIDKey).(string)
+	input := dto.PinLoginInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	wait, err := reservePin(input.UserID, deviceID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+
+	var user models.User
+	dbResult := models.DB.Preload("Role").Where("ID = ? AND active", input.UserID).First(&user)
+	if dbResult.Error != nil || user.PinHash == "" || utils.CheckPassword(user.PinHash, input.Pin) != nil {
+		recordLoginEvent(r, "pin:"+input.UserID, nil, false, "bad_pin")
+		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid PIN", "")
+		return
+	}
+	pinSucceeded(user.ID, deviceID)
+
+	refreshToken, err := utils.RandomToken()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		DeviceID:         &deviceID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        r.UserAgent(),
+		IP:               utils.ClientIP(r),
+		ExpiresAt:        now.Add(pinTokenTTL),
+		LastUsedAt:       now,
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).
+			Where("device_id = ? AND revoked_at IS NULL", deviceID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&session).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	closeEndedSessions()
+	token, err := utils.Tokens.Sign(&utils.Claims{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+		},
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate token", err.Error())
+		return
+	}
+	recordLoginEvent(r, user.Login, &user.ID, true, "pin")
+	utils.RespondWithSuccess(w, http.StatusOK, "Switched user", dto.PinLoginResponse{
+		Token:     token,
+		ExpiresIn: int64(pinTokenTTL.Seconds()),
+		User:      dto.NewStaff(user),
+	})
+}
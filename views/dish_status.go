@@ -0,0 +1,160 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// orderDishStatus is the dish status all lines reach when the order itself
+// reaches the order status.
+var orderDishStatus = map[models.OrderStatus]models.DishStatus{
+	models.OrderReady:  models.DishReady,
+	models.OrderServed: models.DishServed,
+}
+
+// catchUpDishes moves lines lagging behind an order marked ready or served
+// as a whole.
+func catchUpDishes(tx *gorm.DB, orderID string, to models.OrderStatus) error {
+	target, ok := orderDishStatus[to]
+	if !ok {
+		return nil
+	}
+	var lines []models.OrderFood
+	if err := tx.Where("order_id = ?", orderID).Find(&lines).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range lines {
+		if lines[i].Status.Before(target) {
+			lines[i].SetStatus(target, now)
+			if err := models.SaveDishStatus(tx, &lines[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// followDishes returns the order status implied by the status of its lines:
+// cooking once any line is being cooked, ready once all are ready and served
+// once all are served. It never moves an order backwards.
+func followDishes(order *models.Order, lines []models.OrderFood) models.OrderStatus {
+	slowest, fastest := models.DishServed, models.DishQueued
+	for _, line := range lines {
+		if line.Status.Before(slowest) {
+			slowest = line.Status
+		}
+		if fastest.Before(line.Status) {
+			fastest = line.Status
+		}
+	}
+	steps := []models.OrderStatus{models.OrderAccepted, models.OrderCooking, models.OrderReady, models.OrderServed}
+	target := models.OrderAccepted
+	switch {
+	case slowest == models.DishServed:
+		target = models.OrderServed
+	case !slowest.Before(models.DishReady):
+		target = models.OrderReady
+	case fastest != models.DishQueued:
+		target = models.OrderCooking
+	}
+	for _, step := range steps {
+		if step == order.Status {
+			return target
+		}
+		if step == target {
+			return order.Status
+		}
+	}
+	return order.Status
+}
+
+// UpdateDishStatus lets the kitchen move a single line forward. The order
+// follows its lines, so it becomes ready when the last dish is ready.
+func UpdateDishStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var input dto.DishStatusInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if !input.Status.Valid() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", fmt.Sprintf("Unknown status %q", input.Status))
+		return
+	}
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	var order models.Order
+	var line models.OrderFood
+	orderChanged := false
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "ID = ?", vars["id"]).Error; err != nil {
+			return err
+		}
+		switch order.Status {
+		case models.OrderAccepted, models.OrderCooking, models.OrderReady:
+		case models.OrderPending:
+			return &orderError{http.StatusConflict, "Order is not accepted yet", "Accept the order before cooking it"}
+		default:
+			return &orderError{http.StatusConflict, "Order is closed", fmt.Sprintf("The order is %s", order.Status)}
+		}
+		var lines []models.OrderFood
+		if err := tx.Where("order_id = ?", order.ID).Find(&lines).Error; err != nil {
+			return err
+		}
+		i, err := findOrderLine(lines, vars["item_id"])
+		if err != nil {
+			return err
+		}
+		if !lines[i].Status.Before(input.Status) {
+			return &orderError{http.StatusConflict, "Invalid status transition", fmt.Sprintf("A dish cannot go from %q to %q", lines[i].Status, input.Status)}
+		}
+		lines[i].SetStatus(input.Status, time.Now())
+		if err := models.SaveDishStatus(tx, &lines[i]); err != nil {
+			return err
+		}
+		line = lines[i]
+		if next := followDishes(&order, lines); next != order.Status {
+			orderChanged = true
+			return setOrderStatus(tx, r, &order, next, "", &userID)
+		}
+		return nil
+	})
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Order or item not found", err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update dish status", err.Error())
+		return
+	}
+	event := utils.WebSocketMessage{
+		Event: "dish_status_updated",
+		Data:  dto.DishStatusEvent{OrderID: order.ID, TableID: order.TableID, OrderStatus: order.Status, Item: dto.NewOrderFood(line)},
+	}
+	broadcastToGuests(event, order)
+	HubInstance.BroadcastToRoom(staffRoom, event)
+	if orderChanged {
+		models.DB.Preload("Table").Preload("OrderFood").First(&order, "ID = ?", order.ID)
+		broadcastOrder("status_updated", order)
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Dish status updated", dto.NewOrderFood(line))
+}
@@ -4,21 +4,33 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
 	"github.com/davronkhamdamov/restaraunt_backend/models"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
 	"github.com/gorilla/mux"
 )
 
 func CreateFeedback(w http.ResponseWriter, r *http.Request) {
-	feedback := models.Feedback{}
-	if err := json.NewDecoder(r.Body).Decode(&feedback); err != nil {
+	input := dto.FeedbackInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(feedback); err != nil {
+	if err := validate.Struct(input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
+	tableID, _ := r.Context().Value(middleware.TableIDKey).(string)
+	sessionID, _ := r.Context().Value(middleware.TableSessionIDKey).(string)
+	if input.OrderID != "" {
+		var order models.Order
+		if dbResult := models.DB.Where("ID = ? AND table_session_id = ?", input.OrderID, sessionID).First(&order); dbResult.Error != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Order does not belong to this table session", dbResult.Error.Error())
+			return
+		}
+	}
+	feedback := input.Model(tableID)
 	if dbResult := models.DB.Create(&feedback); dbResult.Error != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create feedback", dbResult.Error.Error())
 		return
@@ -69,7 +81,7 @@ func GetFeedback(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusNotFound, "Feedback not found", dbResult.Error.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", feedback)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewFeedback(feedback))
 }
 func GetAllFeedback(w http.ResponseWriter, r *http.Request) {
 	categories := []models.Feedback{}
@@ -77,7 +89,7 @@ func GetAllFeedback(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch categories", dbResult.Error.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", categories)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewFeedbackList(categories))
 }
 func DeleteFeedback(w http.ResponseWriter, r *http.Request) {
 	feedback := models.Feedback{}
@@ -2,26 +2,54 @@ package views
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
 	"github.com/davronkhamdamov/restaraunt_backend/models"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
+// categoryExists answers 400 when the food's category does not exist.
+func categoryExists(w http.ResponseWriter, categoryID string) bool {
+	err := models.DB.Select("id").First(&models.Category{}, "ID = ?", categoryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Category not found", categoryID)
+		return false
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return false
+	}
+	return true
+}
+
 func CreateFood(w http.ResponseWriter, r *http.Request) {
-	food := models.Food{}
-	if err := json.NewDecoder(r.Body).Decode(&food); err != nil {
+	input := dto.FoodInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(food); err != nil {
+	if err := validate.Struct(input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
+	if !categoryExists(w, input.CategoryID) {
+		return
+	}
+	food := models.Food{}
+	input.Apply(&food)
 	food.Available = true
-	if dbResult := models.DB.Create(&food); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create food", dbResult.Error.Error())
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&food).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "food", food.ID, nil, dto.NewFood(food))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create food", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusCreated, "Food created successfully", nil)
@@ -34,7 +62,7 @@ func GetFood(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get food", dbResult.Error.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", food)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewFood(food))
 }
 func GetAllFood(w http.ResponseWriter, r *http.Request) {
 	foods := []models.Food{}
@@ -55,7 +83,7 @@ func GetAllFood(w http.ResponseWriter, r *http.Request) {
 			foods[i].Name = food.NameEn
 		}
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", foods)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewFoodList(foods))
 }
 
 // func GetCategoriesAndFoods(w http.ResponseWriter, r *http.Request) {
@@ -146,7 +174,7 @@ func GetCategoriesAndFoods(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", validCategories)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewCategoryList(validCategories))
 }
 func UpdateFood(w http.ResponseWriter, r *http.Request) {
 	food := models.Food{}
@@ -156,16 +184,28 @@ func UpdateFood(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update food", dbResult.Error.Error())
 		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&food); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	input := dto.FoodInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(food); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if dbResult := models.DB.Save(&food); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	if !categoryExists(w, input.CategoryID) {
+		return
+	}
+	before := dto.NewFood(food)
+	input.Apply(&food)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&food).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "food", food.ID, before, dto.NewFood(food))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusOK, "OK", nil)
@@ -178,8 +218,14 @@ func DeleteFood(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to delete food", dbResult.Error.Error())
 		return
 	}
-	if dbResult := models.DB.Delete(&food); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&food).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditDelete, "food", food.ID, dto.NewFood(food), nil)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusOK, "OK", nil)
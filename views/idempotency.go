@@ -0,0 +1,80 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotency-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+var errIdempotencyMismatch = errors.New("idempotency key was used with a different request")
+
+// idempotencyTTL is how long a stored response is replayed. InitOrders reads
+// it from IDEMPOTENCY_TTL.
+var idempotencyTTL = 24 * time.Hour
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	return utils.HashToken(r.Method + " " + r.URL.Path + "\n" + string(body))
+}
+
+// storedResponse returns the response saved for key, nil when there is
+// none, or errIdempotencyMismatch when the key was used for another request.
+func storedResponse(db *gorm.DB, scope, key, fingerprint string) (*models.IdempotencyKey, error) {
+	var stored models.IdempotencyKey
+	dbResult := db.Where("scope = ? AND key = ? AND expires_at > ?", scope, key, time.Now()).Limit(1).Find(&stored)
+	if dbResult.Error != nil || dbResult.RowsAffected == 0 {
+		return nil, dbResult.Error
+	}
+	if stored.Fingerprint != fingerprint {
+		return nil, errIdempotencyMismatch
+	}
+	return &stored, nil
+}
+
+// claimIdempotencyKey inserts the key inside the transaction that carries
+// out the request, after dropping expired keys. A concurrent retry blocks on
+// the insert until that transaction ends and then fails with
+// gorm.ErrDuplicatedKey.
+func claimIdempotencyKey(tx *gorm.DB, scope, key, fingerprint string) (*models.IdempotencyKey, error) {
+	if err := tx.Where("scope = ? AND key = ? AND expires_at <= ?", scope, key, time.Now()).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, err
+	}
+	claimed := &models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Response:    []byte{},
+		ExpiresAt:   time.Now().Add(idempotencyTTL),
+	}
+	return claimed, tx.Create(claimed).Error
+}
+
+func saveIdempotentResponse(tx *gorm.DB, claimed *models.IdempotencyKey, statusCode int, body []byte) error {
+	claimed.StatusCode = statusCode
+	claimed.Response = body
+	return tx.Model(claimed).Select("status_code", "response").Updates(claimed).Error
+}
+
+func replayResponse(w http.ResponseWriter, stored *models.IdempotencyKey) {
+	w.Header().Set(idempotencyReplayedHeader, "true")
+	utils.RespondWithRaw(w, stored.StatusCode, stored.Response)
+}
+
+// respondIdempotencyError handles the outcomes of storedResponse and
+// claimIdempotencyKey that end the request.
+func respondIdempotencyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errIdempotencyMismatch) {
+		utils.RespondWithError(w, http.StatusUnprocessableEntity, "Idempotency key reused", err.Error())
+		return
+	}
+	utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+}
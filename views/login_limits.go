@@ -0,0 +1,202 @@
+package views
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+)
+
+var (
+	loginLimiter     *utils.Limiter
+	ipLimiter        *utils.Limiter
+	pinLimiter       *utils.Limiter
+	pinDeviceLimiter *utils.Limiter
+	pinTokenTTL      time.Duration
+)
+
+// InitLoginProtection builds the login and PIN limiters. LOGIN_ATTEMPT_STORE
+// picks where counters live: "memory" (default) or "postgres". The per-IP
+// and per-device limits are much higher than the per-user ones because every
+// tablet in the restaurant usually shares one public address and every
+// waiter on a shift shares one tablet.
+func InitLoginProtection() error {
+	loginPolicy, err := utils.LimiterPolicyFromEnv("LOGIN", utils.LimiterPolicy{
+		MaxFailures: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Lockout:     15 * time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+	ipPolicy, err := utils.LimiterPolicyFromEnv("LOGIN_IP", utils.LimiterPolicy{
+		MaxFailures: 50,
+		BaseDelay:   0,
+		MaxDelay:    0,
+		Lockout:     15 * time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+	pinPolicy, err := utils.LimiterPolicyFromEnv("PIN", utils.LimiterPolicy{
+		MaxFailures: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Lockout:     5 * time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+	pinDevicePolicy, err := utils.LimiterPolicyFromEnv("PIN_DEVICE", utils.LimiterPolicy{
+		MaxFailures: 20,
+		Lockout:     5 * time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+	ttl, err := time.ParseDuration(cmp.Or(utils.GetEnv("PIN_TOKEN_TTL"), "30m"))
+	if err != nil {
+		return fmt.Errorf("PIN_TOKEN_TTL: %w", err)
+	}
+	var store utils.AttemptStore
+	switch utils.GetEnv("LOGIN_ATTEMPT_STORE") {
+	case "", "memory":
+		store = utils.NewMemoryAttemptStore(max(loginPolicy.Lockout, ipPolicy.Lockout, pinPolicy.Lockout, pinDevicePolicy.Lockout))
+	case "postgres":
+		store = models.NewDBAttemptStore(models.DB)
+	default:
+		return fmt.Errorf("LOGIN_ATTEMPT_STORE must be memory or postgres")
+	}
+	loginLimiter = utils.NewLimiter(store, loginPolicy)
+	ipLimiter = utils.NewLimiter(store, ipPolicy)
+	pinLimiter = utils.NewLimiter(store, pinPolicy)
+	pinDeviceLimiter = utils.NewLimiter(store, pinDevicePolicy)
+	pinTokenTTL = ttl
+	return nil
+}
+
+func loginKey(login string) string {
+	return "login:" + strings.ToLower(login)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// reserveLogin counts an attempt against both the login and the address
+// before the password is checked, see utils.Limiter.Reserve. A non-zero wait
+// means the attempt was refused and nothing was counted.
+func reserveLogin(login, ip string) (time.Duration, error) {
+	wait, err := loginLimiter.Reserve(loginKey(login))
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	if wait, err = ipLimiter.Reserve(ipKey(ip)); err != nil || wait > 0 {
+		return wait, errors.Join(err, loginLimiter.Release(loginKey(login)))
+	}
+	return 0, nil
+}
+
+// loginSucceeded forgets the failures of the login and gives the address its
+// reserved attempt back.
+func loginSucceeded(login, ip string) {
+	if err := errors.Join(loginLimiter.Reset(loginKey(login)), ipLimiter.Release(ipKey(ip))); err != nil {
+		log.Println("Failed to reset login attempts:", err)
+	}
+}
+
+func pinKey(userID string) string {
+	return "pin:" + userID
+}
+
+func deviceKey(deviceID string) string {
+	return "device:" + deviceID
+}
+
+func reservePin(userID, deviceID string) (time.Duration, error) {
+	wait, err := pinLimiter.Reserve(pinKey(userID))
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	if wait, err = pinDeviceLimiter.Reserve(deviceKey(deviceID)); err != nil || wait > 0 {
+		return wait, errors.Join(err, pinLimiter.Release(pinKey(userID)))
+	}
+	return 0, nil
+}
+
+func pinSucceeded(userID, deviceID string) {
+	if err := errors.Join(pinLimiter.Reset(pinKey(userID)), pinDeviceLimiter.Release(deviceKey(deviceID))); err != nil {
+		log.Println("Failed to reset PIN attempts:", err)
+	}
+}
+
+func recordLoginEvent(r *http.Request, login string, userID *string, success bool, reason string) {
+	event := models.LoginEvent{
+		Login:     login,
+		UserID:    userID,
+		IP:        utils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   success,
+		Reason:    reason,
+	}
+	if err := models.DB.Create(&event).Error; err != nil {
+		log.Println("Failed to record login event:", err)
+	}
+}
+
+func respondTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	utils.RespondWithError(w, http.StatusTooManyRequests, "Too many failed attempts", fmt.Sprintf("Try again in %d seconds", seconds))
+}
+
+func UnlockStaff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var staff models.User
+	if dbResult := models.DB.Where("ID = ?", vars["id"]).First(&staff); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Staff not found", dbResult.Error.Error())
+		return
+	}
+	if err := errors.Join(loginLimiter.Reset(loginKey(staff.Login)), pinLimiter.Reset(pinKey(staff.ID))); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	if err := audit(models.DB, r, models.AuditUpdate, "staff", staff.ID, map[string]any{"lockout": "reset"}, nil); err != nil {
+		log.Println("Failed to audit unlock:", err)
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Staff unlocked successfully", nil)
+}
+func GetLoginEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	db := models.DB.Order("created_at DESC").Limit(limit)
+	if login := query.Get("login"); login != "" {
+		db = db.Where("login = ?", login)
+	}
+	if ip := query.Get("ip"); ip != "" {
+		db = db.Where("ip = ?", ip)
+	}
+	if success := query.Get("success"); success != "" {
+		db = db.Where("success = ?", success == "true")
+	}
+	var events []models.LoginEvent
+	if dbResult := db.Find(&events); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewLoginEventList(events))
+}
@@ -0,0 +1,85 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"gorm.io/gorm"
+)
+
+func GetMe(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey)
+	var user models.User
+	if dbResult := models.DB.Preload("Role.Permissions").Where("ID = ?", userID).First(&user); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewStaff(user))
+}
+
+// ChangeMyPassword checks the old password against the same limiter as login,
+// so a stolen access token cannot be used to guess it, and signs out every
+// other session of the user.
+func ChangeMyPassword(w http.ResponseWriter, r *http.Request) {
+	var input dto.ChangePasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	userID := r.Context().Value(middleware.UserIDKey)
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+	var user models.User
+	if dbResult := models.DB.Where("ID = ?", userID).First(&user); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found", dbResult.Error.Error())
+		return
+	}
+	ip := utils.ClientIP(r)
+	wait, err := reserveLogin(user.Login, ip)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	if wait > 0 {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	if err := utils.CheckPassword(user.Password, input.OldPassword); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Old password is incorrect", "")
+		return
+	}
+	loginSucceeded(user.Login, ip)
+	if err := utils.Passwords.Check(input.NewPassword, user.Login); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Password does not meet the policy", err.Error())
+		return
+	}
+	hashed, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	before := dto.NewStaff(user)
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hashed).Error; err != nil {
+			return err
+		}
+		if err := models.RevokeOtherSessions(tx, user.ID, sessionID); err != nil {
+			return err
+		}
+		after := staffAudit{StaffResponse: dto.NewStaff(user), PasswordChanged: true}
+		return audit(tx, r, models.AuditUpdate, "staff", user.ID, before, after)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to change password", err.Error())
+		return
+	}
+	closeEndedSessions()
+	utils.RespondWithSuccess(w, http.StatusOK, "Password changed, other sessions signed out", nil)
+}
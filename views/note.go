@@ -0,0 +1,202 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// editOrderNote locks the open order of the URL, lets edit change a note on
+// it and sends the order to the table and staff as order_updated.
+func editOrderNote(w http.ResponseWriter, r *http.Request, edit func(tx *gorm.DB, order *models.Order) error) {
+	var order models.Order
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "ID = ?", mux.Vars(r)["id"]).Error; err != nil {
+			return err
+		}
+		if !slices.Contains(models.OpenOrderStatuses, order.Status) {
+			return &orderError{http.StatusConflict, "Order can no longer be changed", fmt.Sprintf("The order is %s", order.Status)}
+		}
+		if err := tx.Where("order_id = ?", order.ID).Order("created_at").Find(&order.OrderFood).Error; err != nil {
+			return err
+		}
+		before := dto.NewOrder(order)
+		if err := edit(tx, &order); err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "order", order.ID, before, dto.NewOrder(order))
+	})
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Order or item not found", err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update note", err.Error())
+		return
+	}
+	models.DB.Preload("Table").First(&order, "ID = ?", order.ID)
+	event := utils.WebSocketMessage{
+		Event: "order_updated",
+		Data:  dto.OrderUpdatedEvent{Order: dto.NewOrder(order), Diff: dto.OrderItemsDiff{}},
+	}
+	broadcastToGuests(event, order)
+	HubInstance.BroadcastToRoom(staffRoom, event)
+	utils.RespondWithSuccess(w, http.StatusOK, "Note updated", dto.NewOrder(order))
+}
+
+// UpdateOrderNote sets the staff note of an order. The guest's own note is
+// left as they wrote it.
+func UpdateOrderNote(w http.ResponseWriter, r *http.Request) {
+	var input dto.OrderNoteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	editOrderNote(w, r, func(tx *gorm.DB, order *models.Order) error {
+		order.StaffNote = strings.TrimSpace(input.Note)
+		return tx.Model(order).Update("staff_note", order.StaffNote).Error
+	})
+}
+
+// UpdateOrderItemNote replaces the note of one line until it is served.
+func UpdateOrderItemNote(w http.ResponseWriter, r *http.Request) {
+	var input dto.OrderItemNoteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	itemID := mux.Vars(r)["item_id"]
+	editOrderNote(w, r, func(tx *gorm.DB, order *models.Order) error {
+		i, err := findOrderLine(order.OrderFood, itemID)
+		if err != nil {
+			return err
+		}
+		line := &order.OrderFood[i]
+		if line.Status == models.DishServed {
+			return &orderError{http.StatusConflict, "Item is already served", line.NameEn}
+		}
+		line.Note = strings.TrimSpace(input.Note)
+		return tx.Model(line).Update("note", line.Note).Error
+	})
+}
+
+func GetNotePresets(w http.ResponseWriter, r *http.Request) {
+	var presets []models.FoodNotePreset
+	lang := r.URL.Query().Get("lang")
+	if err := models.DB.Where("food_id = ?", mux.Vars(r)["id"]).Order("created_at").Find(&presets).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get note presets", err.Error())
+		return
+	}
+	for i, preset := range presets {
+		switch lang {
+		case "uz":
+			presets[i].Name = preset.NameUz
+		case "ru":
+			presets[i].Name = preset.NameRu
+		default:
+			presets[i].Name = preset.NameEn
+		}
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewNotePresetList(presets))
+}
+
+func CreateNotePreset(w http.ResponseWriter, r *http.Request) {
+	var input dto.NotePresetInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	var food models.Food
+	if err := models.DB.First(&food, "ID = ?", mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Food not found", err.Error())
+		return
+	}
+	preset := models.FoodNotePreset{FoodID: food.ID}
+	input.Apply(&preset)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&preset).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "note_preset", preset.ID, nil, dto.NewNotePreset(preset))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create note preset", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusCreated, "Note preset created successfully", dto.NewNotePreset(preset))
+}
+
+func UpdateNotePreset(w http.ResponseWriter, r *http.Request) {
+	var input dto.NotePresetInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	var preset models.FoodNotePreset
+	if err := models.DB.First(&preset, "ID = ?", mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Note preset not found", err.Error())
+		return
+	}
+	before := dto.NewNotePreset(preset)
+	input.Apply(&preset)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&preset).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "note_preset", preset.ID, before, dto.NewNotePreset(preset))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewNotePreset(preset))
+}
+
+func DeleteNotePreset(w http.ResponseWriter, r *http.Request) {
+	var preset models.FoodNotePreset
+	if err := models.DB.First(&preset, "ID = ?", mux.Vars(r)["id"]).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Note preset not found", err.Error())
+		return
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&preset).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditDelete, "note_preset", preset.ID, dto.NewNotePreset(preset), nil)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", nil)
+}
@@ -1,49 +1,50 @@
 package views
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
 	"github.com/davronkhamdamov/restaraunt_backend/middleware"
 	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"gorm.io/gorm"
 )
 
-var your_secret_key = []byte("your_secret_key")
 var HubInstance = utils.NewHub()
 
-type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-type OrderRequest struct {
-	OrderID string `json:"order_id" validate:"required"`
-}
-
 var Clients = make(map[*websocket.Conn]bool)
 
+// NewOrder honours the Idempotency-Key header: a retry with the same key and
+// body gets the stored response and creates no second order.
 func NewOrder(w http.ResponseWriter, r *http.Request) {
-	var request models.Order
+	var request dto.OrderInput
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
@@ -53,9 +54,31 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tableID, _ := r.Context().Value(middleware.TableIDKey).(string)
+	sessionID, _ := r.Context().Value(middleware.TableSessionIDKey).(string)
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	fingerprint := requestFingerprint(r, body)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid idempotency key", fmt.Sprintf("The key must be at most %d characters long", maxIdempotencyKeyLength))
+		return
+	}
+	if idempotencyKey != "" {
+		stored, err := storedResponse(models.DB, sessionID, idempotencyKey, fingerprint)
+		if err != nil {
+			respondIdempotencyError(w, err)
+			return
+		}
+		if stored != nil {
+			replayResponse(w, stored)
+			return
+		}
+	}
+
 	order := models.Order{
-		TableID: request.TableID,
-		Status:  "pending",
+		TableID:        tableID,
+		TableSessionID: &sessionID,
+		Status:         models.OrderPending,
+		Note:           strings.TrimSpace(request.Note),
 	}
 	tx := models.DB.Begin()
 	if tx.Error != nil {
@@ -63,6 +86,25 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var claimed *models.IdempotencyKey
+	if idempotencyKey != "" {
+		if claimed, err = claimIdempotencyKey(tx, sessionID, idempotencyKey, fingerprint); err != nil {
+			tx.Rollback()
+			if !errors.Is(err, gorm.ErrDuplicatedKey) {
+				respondIdempotencyError(w, err)
+				return
+			}
+			// A concurrent request with the same key has just finished.
+			stored, err := storedResponse(models.DB, sessionID, idempotencyKey, fingerprint)
+			if err != nil || stored == nil {
+				respondIdempotencyError(w, cmp.Or(err, errIdempotencyMismatch))
+				return
+			}
+			replayResponse(w, stored)
+			return
+		}
+	}
+
 	if err := createOrder(tx, &order); err != nil {
 		tx.Rollback()
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create order", err.Error())
@@ -71,28 +113,71 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 
 	if err := processOrderFoods(tx, &order, request); err != nil {
 		tx.Rollback()
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create order foods", err.Error())
+		var refused *orderError
+		switch {
+		case errors.As(err, &refused):
+			utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.RespondWithError(w, http.StatusBadRequest, "Food not found", err.Error())
+		case errors.Is(err, pricing.ErrTooLarge):
+			utils.RespondWithError(w, http.StatusBadRequest, "Order is too large", err.Error())
+		default:
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to create order foods", err.Error())
+		}
 		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+	if err := models.RecordOrderStatus(tx, order.ID, "", order.Status, nil); err != nil {
+		tx.Rollback()
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to record order status", err.Error())
 		return
 	}
+
 	var table models.Table
-	if dbResult := models.DB.Where("ID = ?", order.TableID).Find(&table); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve orders", dbResult.Error.Error)
+	if dbResult := tx.Where("ID = ?", order.TableID).Find(&table); dbResult.Error != nil {
+		tx.Rollback()
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to retrieve orders", dbResult.Error.Error())
+		return
 	}
 	order.Table = table
-	HubInstance.BroadcastToAll(utils.WebSocketMessage{
+
+	response, err := json.Marshal(utils.Response{
+		StatusCode: http.StatusCreated,
+		Message:    "Order created successfully",
+		Data:       dto.NewOrder(order),
+	})
+	if err != nil {
+		tx.Rollback()
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	if claimed != nil {
+		if err := saveIdempotentResponse(tx, claimed, http.StatusCreated, response); err != nil {
+			tx.Rollback()
+			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to store response", err.Error())
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+	HubInstance.BroadcastToRoom(staffRoom, utils.WebSocketMessage{
 		Event: "new_order",
-		Data:  order,
+		Data:  dto.NewOrder(order),
 	})
-	utils.RespondWithSuccess(w, http.StatusCreated, "Order created successfully", order)
+	utils.RespondWithRaw(w, http.StatusCreated, response)
 }
 
 func createOrder(tx *gorm.DB, order *models.Order) error {
-	order.OrderId = utils.GenerateOrderID()
+	order.BusinessDay = orderNumbers.BusinessDay(time.Now())
+	sequence, err := models.NextOrderSequence(tx, order.BusinessDay)
+	if err != nil {
+		return err
+	}
+	order.Sequence = sequence
+	order.OrderId = orderNumbers.Number(sequence)
 	dbResult := tx.Create(order)
 	if dbResult.Error != nil {
 		return dbResult.Error
@@ -100,49 +185,59 @@ func createOrder(tx *gorm.DB, order *models.Order) error {
 	return nil
 }
 
-func processOrderFoods(tx *gorm.DB, order *models.Order, request models.Order) error {
-	var total uint = 0
-
-	for i := range request.OrderFood {
-		orderFood := models.OrderFood{
-			OrderID:  order.ID,
-			FoodID:   request.OrderFood[i].FoodID,
-			Quantity: request.OrderFood[i].Quantity,
-		}
-		var food models.Food
-		var category models.Category
-		if err := tx.First(&food, "ID = ?", orderFood.FoodID).Error; err != nil {
+func processOrderFoods(tx *gorm.DB, order *models.Order, request dto.OrderInput) error {
+	for i := range request.Foods {
+		orderFood, err := newOrderFood(tx, order.ID, request.Foods[i])
+		if err != nil {
 			return err
 		}
-		if err := tx.First(&category, "ID = ?", food.CategoryID).Error; err != nil {
-			return err
-		}
-		orderFood.Weight = food.Weight
-		orderFood.NameUz = food.NameUz
-		orderFood.NameRu = food.NameRu
-		orderFood.NameEn = food.NameEn
-		orderFood.WeightType = food.WeightType
-		orderFood.Price = food.Price
-		orderFood.Image = food.ImageUrl
-		orderFood.DescriptionUz = food.DescriptionUz
-		orderFood.DescriptionRu = food.DescriptionRu
-		orderFood.DescriptionEn = food.DescriptionEn
-		orderFood.CategoryNameUz = category.NameUz
-		orderFood.CategoryNameRu = category.NameRu
-		orderFood.CategoryNameEn = category.NameEn
-		total += food.Price * orderFood.Quantity
 		if err := tx.Create(&orderFood).Error; err != nil {
 			return err
 		}
+		order.OrderFood = append(order.OrderFood, orderFood)
 	}
 
-	order.Total = total
-	if err := tx.Save(order).Error; err != nil {
-		return err
-	}
+	return models.PriceOrder(tx, order)
+}
 
-	return nil
+// newOrderFood copies the food and its category into a new order line, so
+// later menu changes do not alter placed orders. Foods that are not
+// available are refused.
+func newOrderFood(tx *gorm.DB, orderID string, input dto.OrderFoodInput) (models.OrderFood, error) {
+	orderFood := models.OrderFood{
+		OrderID:  orderID,
+		FoodID:   input.FoodID,
+		Quantity: input.Quantity,
+		Status:   models.DishQueued,
+		Note:     strings.TrimSpace(input.Note),
+	}
+	var food models.Food
+	var category models.Category
+	if err := tx.First(&food, "ID = ?", orderFood.FoodID).Error; err != nil {
+		return orderFood, err
+	}
+	if !food.Available {
+		return orderFood, &orderError{http.StatusConflict, "Food is not available", food.NameEn}
+	}
+	if err := tx.First(&category, "ID = ?", food.CategoryID).Error; err != nil {
+		return orderFood, err
+	}
+	orderFood.Weight = food.Weight
+	orderFood.NameUz = food.NameUz
+	orderFood.NameRu = food.NameRu
+	orderFood.NameEn = food.NameEn
+	orderFood.WeightType = food.WeightType
+	orderFood.Price = food.Price
+	orderFood.Image = food.ImageUrl
+	orderFood.DescriptionUz = food.DescriptionUz
+	orderFood.DescriptionRu = food.DescriptionRu
+	orderFood.DescriptionEn = food.DescriptionEn
+	orderFood.CategoryNameUz = category.NameUz
+	orderFood.CategoryNameRu = category.NameRu
+	orderFood.CategoryNameEn = category.NameEn
+	return orderFood, nil
 }
+
 func GetOrder(w http.ResponseWriter, r *http.Request) {
 	var orders models.Order
 	vars := mux.Vars(r)
@@ -166,157 +261,97 @@ func GetOrder(w http.ResponseWriter, r *http.Request) {
 		}
 		orders.OrderFood[i].Name = foodNameToReturn
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Orders retrieved successfully", orders)
+	utils.RespondWithSuccess(w, http.StatusOK, "Orders retrieved successfully", dto.NewOrder(orders))
 }
-func getOrdersFromDB() ([]models.Order, error) {
+
+// GetOrders lists orders a page at a time; see parseOrderQuery for the
+// filters.
+func GetOrders(w http.ResponseWriter, r *http.Request) {
+	query, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid query", err.Error())
+		return
+	}
 	var orders []models.Order
-	if err := models.DB.
-		Order("Created_At DESC").
+	if err := query.page(models.DB).
 		Preload("Feedback").
 		Preload("Table").
 		Find(&orders).Error; err != nil {
-		return nil, err
-	}
-	return orders, nil
-}
-func GetOrders(w http.ResponseWriter, r *http.Request) {
-	orders, err := getOrdersFromDB()
-	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get orders", err.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Orders retrieved successfully", orders)
+	orders, next := query.nextCursor(orders)
+	utils.RespondWithSuccess(w, http.StatusOK, "Orders retrieved successfully", dto.OrderPage{
+		Items:      dto.NewOrderList(orders),
+		Limit:      query.Limit,
+		NextCursor: next,
+	})
 }
+
+// GetOrdersForStaff is the board of orders the waiter received or nobody
+// has yet. It takes the filters of GetOrders, defaulting to the open
+// statuses, and is not paged so the board is always complete.
 func GetOrdersForStaff(w http.ResponseWriter, r *http.Request) {
+	query, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid query", err.Error())
+		return
+	}
+	if len(query.Statuses) == 0 {
+		query.Statuses = models.OpenOrderStatuses
+	}
 	userID := r.Context().Value(middleware.UserIDKey)
 	var orders []models.Order
-	if err := models.DB.
-		Where("status IN ?", []string{"in_process", "pending"}).
+	if err := query.order(query.filter(models.DB)).
 		Where("user_id = ? OR user_id IS NULL", userID).
-		Order("Created_At DESC").
+		Preload("OrderFood").
 		Preload("Table").
-		Find(&orders); err.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get orders", err.Error.Error())
+		Find(&orders).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get orders", err.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Orders retrieved successfully", orders)
-}
-
-func authenticateWebSocket(r *http.Request) (string, error) {
-	tokenString := r.URL.Query().Get("token")
-	if tokenString == "" {
-		return "", fmt.Errorf("authorization header is missing")
-	}
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return your_secret_key, nil
-	})
-	if err != nil || !token.Valid {
-		return "", fmt.Errorf("invalid token: %v", err)
-	}
-	return claims.UserID, nil
+	utils.RespondWithSuccess(w, http.StatusOK, "Orders retrieved successfully", dto.NewOrderList(orders))
 }
 
+// Orders redeems the ticket from POST /v1/ws/ticket before upgrading, so an
+// unauthenticated caller never gets a connection.
 func Orders(w http.ResponseWriter, r *http.Request) {
+	subject, ok := wsTickets.Redeem(r.URL.Query().Get("ticket"))
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired ticket", nil)
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Upgrade error:", err)
 		return
 	}
-	userId, errAuth := authenticateWebSocket(r)
-	if errAuth != nil {
-		log.Println("Authentication failed:", err)
-	}
-	tableID := r.URL.Query().Get("table_id")
 
 	client := &utils.Client{
-		Conn:   conn,
-		UserID: userId,
-		Rooms:  make(map[string]bool),
+		Conn:      conn,
+		UserID:    subject.UserID,
+		SessionID: subject.SessionID,
+		Kind:      subject.Kind,
+		Rooms:     make(map[string]bool),
+	}
+	HubInstance.Register(client)
+	HubInstance.JoinRoom(client, client.SessionID)
+	if subject.Kind == utils.TicketUser {
+		HubInstance.JoinRoom(client, client.UserID)
+		HubInstance.JoinRoom(client, staffRoom)
 	}
-	if tableID != "" {
-		client.UserID = tableID
-	}
-	HubInstance.Clients[client] = true
-	HubInstance.JoinRoom(client, client.UserID)
 	go readPump(client)
 }
-func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	orderID := vars["id"]
-	userID := r.Context().Value(middleware.UserIDKey)
-
-	var order models.Order
-	if err := models.DB.First(&order, "ID = ?", orderID).Error; err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Order not found", err.Error())
-		return
-	}
-	if order.Status == "done" {
-		utils.RespondWithError(w, http.StatusBadRequest, "Order already has the specified status", nil)
-		return
-	}
-	if userID != *order.UserID {
-		utils.RespondWithError(w, http.StatusBadRequest, "Unauthorized status update attempt", "You must claim the order before changing its status")
-		return
-	}
-	order.Status = "done"
-	if err := models.DB.Save(&order).Error; err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update order status", err.Error())
-		return
-	}
-
-	HubInstance.BroadcastToRoom(order.TableID, utils.WebSocketMessage{
-		Event: "status_updated",
-		Data:  order,
-	})
-	if order.UserID != nil {
-		HubInstance.BroadcastToRoom(*order.UserID, utils.WebSocketMessage{
-			Event: "status_updated",
-			Data:  order,
-		})
-	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Status updated", nil)
-}
-func ReceiveOrder(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	orderID := vars["id"]
-	order := models.Order{}
-	userID := r.Context().Value(middleware.UserIDKey)
-
-	if dbResult := models.DB.First(&order, "ID = ?", orderID).Error; dbResult != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Order not found", dbResult.Error())
-		return
-	}
-	if order.UserID != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Order already received", nil)
-		return
-	}
-	if val, ok := userID.(string); ok {
-		order.UserID = &val
-		order.Status = "in_process"
-		if dbResult := models.DB.Save(&order).Error; dbResult != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update order", dbResult.Error())
-			return
-		}
-		HubInstance.BroadcastToAll(utils.WebSocketMessage{Event: "status_updated", Data: order})
-		utils.RespondWithSuccess(w, http.StatusOK, "Order received", order)
-		return
-	}
-	utils.RespondWithError(w, http.StatusBadRequest, "Failed to order", nil)
-}
 func DeleteAllOrders(w http.ResponseWriter, r *http.Request) {
-	orders := models.Table{}
-
-	if dbResult := models.DB.Where("1 = 1").Delete(&orders); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Orders not found", dbResult.Error.Error())
-		return
-	}
-	if dbResult := models.DB.Delete(&orders); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		dbResult := tx.Where("1 = 1").Delete(&models.Order{})
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		return audit(tx, r, models.AuditDelete, "order", "*", map[string]any{"count": dbResult.RowsAffected}, nil)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusOK, "Orders deleted successfully", nil)
@@ -336,11 +371,23 @@ func DownloadOrderExcel(w http.ResponseWriter, r *http.Request) {
 		CreatedAt      time.Time
 	}
 
-	var results []PopularOrder
-
-	oneWeekAgo := time.Now().AddDate(0, 0, -7)
+	query, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid query", err.Error())
+		return
+	}
+	if query.From == nil && query.To == nil {
+		lastWeek := orderNumbers.BusinessDay(time.Now()).AddDate(0, 0, -7)
+		query.From = &lastWeek
+	}
+	if len(query.Statuses) == 0 {
+		query.Statuses = slices.DeleteFunc(slices.Clone(models.OrderStatuses), func(status models.OrderStatus) bool {
+			return status == models.OrderCancelled || status == models.OrderRejected
+		})
+	}
 
-	models.DB.Table("order_foods").
+	var results []PopularOrder
+	db := models.DB.Table("order_foods").
 		Select(`orders.order_id,
 			order_foods.name_uz,
 	        order_foods.price,
@@ -353,10 +400,11 @@ func DownloadOrderExcel(w http.ResponseWriter, r *http.Request) {
 	        orders.created_at`).
 		Joins("JOIN orders ON orders.id = order_foods.order_id").
 		Joins("JOIN tables ON tables.id = orders.table_id").
-		Joins("LEFT JOIN feedbacks ON orders.id = feedbacks.order_id").
-		Where("order_foods.created_at >= ?", oneWeekAgo).
-		Order("orders.created_at DESC").
-		Scan(&results)
+		Joins("LEFT JOIN feedbacks ON orders.id = feedbacks.order_id")
+	if err := query.order(query.filter(db)).Order("order_foods.created_at").Scan(&results).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch data", err.Error())
+		return
+	}
 
 	exporter := utils.NewTaomExcelExporter()
 	headers := []string{"Buyurtma raqami", "Ovqat nomi", "Ovqat toifasi", "Mijoz davlati", "Narxi (so'm)", "Soni", "O'girligi", "Stol raqami", "Vaqt"}
@@ -385,28 +433,72 @@ func DownloadOrderExcel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-	w.Header().Set("Content-Disposition", `attachment; filename="weekly_orders.xlsx"`)
+	w.Header().Set("Content-Disposition", `attachment; filename="orders.xlsx"`)
 	w.WriteHeader(http.StatusOK)
 	w.Write(buf.Bytes())
 }
+
+// readPump only waits for the client to go away. Events flow from the server
+// to clients, so whatever a client sends is discarded; changes go through the
+// HTTP endpoints, which check permissions.
 func readPump(client *utils.Client) {
 	defer func() {
+		HubInstance.Unregister(client)
 		client.Conn.Close()
 	}()
 	for {
-		var msg utils.WebSocketMessage
-		if err := client.Conn.ReadJSON(&msg); err != nil {
+		if _, _, err := client.Conn.NextReader(); err != nil {
 			break
 		}
-		event := msg.Event
-		data := msg.Data
-
-		switch event {
-		case "status_updated":
-			HubInstance.BroadcastToRoom(client.UserID, utils.WebSocketMessage{
-				Event: "status_updated",
-				Data:  data,
-			})
+	}
+}
+
+// GetOrderByNumber finds an order by the number printed on its ticket. Staff
+// with orders.view can look up any order and pass ?date=YYYY-MM-DD for an
+// earlier business day; guests only find orders of their table session from
+// the current business day.
+func GetOrderByNumber(w http.ResponseWriter, r *http.Request) {
+	sequence, err := orderNumbers.Sequence(mux.Vars(r)["number"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid order number", err.Error())
+		return
+	}
+	query := models.DB.Preload("OrderFood").Preload("Table").Where("sequence = ?", sequence)
+
+	businessDay := orderNumbers.BusinessDay(time.Now())
+	if tokenString := r.Header.Get("Authorization"); tokenString != "" {
+		user, _, err := middleware.Authenticate(tokenString, r.Header.Get(middleware.DeviceTokenHeader))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid token", err.Error())
+			return
+		}
+		if user.Role == nil || !user.Role.Has(models.PermOrdersView) {
+			utils.RespondWithError(w, http.StatusForbidden, "Forbidden", fmt.Sprintf("Permission %q is required", models.PermOrdersView))
+			return
 		}
+		if date := r.URL.Query().Get("date"); date != "" {
+			if businessDay, err = time.Parse(time.DateOnly, date); err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid date", "Date must look like 2006-01-02")
+				return
+			}
+		}
+	} else {
+		session, err := middleware.AuthenticateTable(r.Header.Get(middleware.TableTokenHeader))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid table session", err.Error())
+			return
+		}
+		query = query.Where("table_session_id = ?", session.ID)
+	}
+
+	var order models.Order
+	if err := query.Where("business_day = ?", businessDay).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Order not found", fmt.Sprintf("No order %s on %s", orderNumbers.Number(sequence), businessDay.Format(time.DateOnly)))
+			return
+		}
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get order", err.Error())
+		return
 	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Order retrieved successfully", dto.NewOrder(order))
 }
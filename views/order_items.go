@@ -0,0 +1,194 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/pricing"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// editOrderItems locks the order of the URL, which must belong to the guest's
+// table session, still be pending or accepted and have neither a split nor
+// any payment, lets edit change its lines and saves the recomputed total.
+// The diff returned by edit is broadcast as order_updated.
+func editOrderItems(w http.ResponseWriter, r *http.Request, edit func(tx *gorm.DB, order *models.Order) (dto.OrderItemsDiff, error)) {
+	vars := mux.Vars(r)
+	sessionID, _ := r.Context().Value(middleware.TableSessionIDKey).(string)
+	var order models.Order
+	var diff dto.OrderItemsDiff
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&order, "ID = ? AND table_session_id = ?", vars["id"], sessionID).Error; err != nil {
+			return err
+		}
+		if order.Status != models.OrderPending && order.Status != models.OrderAccepted {
+			return &orderError{http.StatusConflict, "Order can no longer be changed", fmt.Sprintf("The order is %s", order.Status)}
+		}
+		splitID, err := models.ActiveSplitOf(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		if splitID != "" {
+			return &orderError{http.StatusConflict, "Order can no longer be changed", "Its bill has been split"}
+		}
+		confirmed, pending, err := models.PaidAmounts(tx, models.Payment{OrderID: &order.ID})
+		if err != nil {
+			return err
+		}
+		if confirmed+pending > 0 {
+			return &orderError{http.StatusConflict, "Order can no longer be changed", "It already has payments"}
+		}
+		if err := tx.Where("order_id = ?", order.ID).Order("created_at").Find(&order.OrderFood).Error; err != nil {
+			return err
+		}
+		if diff, err = edit(tx, &order); err != nil {
+			return err
+		}
+		err = models.PriceOrder(tx, &order)
+		if errors.Is(err, pricing.ErrTooLarge) {
+			return &orderError{http.StatusBadRequest, "Order is too large", err.Error()}
+		}
+		return err
+	})
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Order or item not found", err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update order", err.Error())
+		return
+	}
+	models.DB.Preload("Table").First(&order, "ID = ?", order.ID)
+	event := utils.WebSocketMessage{
+		Event: "order_updated",
+		Data:  dto.OrderUpdatedEvent{Order: dto.NewOrder(order), Diff: diff},
+	}
+	broadcastToGuests(event, order)
+	if order.UserID != nil {
+		HubInstance.BroadcastToRoom(*order.UserID, event)
+	} else {
+		HubInstance.BroadcastToRoom(staffRoom, event)
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Order updated", dto.NewOrder(order))
+}
+
+func findOrderLine(lines []models.OrderFood, itemID string) (int, error) {
+	for i := range lines {
+		if lines[i].ID == itemID {
+			return i, nil
+		}
+	}
+	return 0, gorm.ErrRecordNotFound
+}
+
+// AddOrderItem adds a food to the order. Adding a food the order already
+// has in the kitchen queue with the same note raises the quantity of that
+// line instead.
+func AddOrderItem(w http.ResponseWriter, r *http.Request) {
+	var input dto.OrderFoodInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	editOrderItems(w, r, func(tx *gorm.DB, order *models.Order) (dto.OrderItemsDiff, error) {
+		diff := dto.OrderItemsDiff{}
+		for i := range order.OrderFood {
+			line := &order.OrderFood[i]
+			if line.FoodID != input.FoodID || line.Status != models.DishQueued || line.Note != strings.TrimSpace(input.Note) {
+				continue
+			}
+			change := dto.OrderItemChange{ID: line.ID, FoodID: line.FoodID, From: line.Quantity, To: line.Quantity + input.Quantity}
+			if change.To > dto.MaxQuantity {
+				return diff, &orderError{http.StatusBadRequest, "Quantity is too large", fmt.Sprintf("A line can hold at most %d", dto.MaxQuantity)}
+			}
+			line.Quantity = change.To
+			diff.Changed = append(diff.Changed, change)
+			return diff, tx.Model(line).Update("quantity", line.Quantity).Error
+		}
+		line, err := newOrderFood(tx, order.ID, input)
+		if err != nil {
+			return diff, err
+		}
+		if err := tx.Create(&line).Error; err != nil {
+			return diff, err
+		}
+		order.OrderFood = append(order.OrderFood, line)
+		diff.Added = append(diff.Added, dto.NewOrderFood(line))
+		return diff, nil
+	})
+}
+
+func UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
+	var input dto.OrderItemQuantityInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	itemID := mux.Vars(r)["item_id"]
+	editOrderItems(w, r, func(tx *gorm.DB, order *models.Order) (dto.OrderItemsDiff, error) {
+		diff := dto.OrderItemsDiff{}
+		i, err := findOrderLine(order.OrderFood, itemID)
+		if err != nil {
+			return diff, err
+		}
+		line := &order.OrderFood[i]
+		if line.Status != models.DishQueued {
+			return diff, &orderError{http.StatusConflict, "Item is already being prepared", fmt.Sprintf("The item is %s", line.Status)}
+		}
+		if line.Quantity == input.Quantity {
+			return diff, nil
+		}
+		diff.Changed = append(diff.Changed, dto.OrderItemChange{ID: line.ID, FoodID: line.FoodID, From: line.Quantity, To: input.Quantity})
+		line.Quantity = input.Quantity
+		return diff, tx.Model(line).Update("quantity", line.Quantity).Error
+	})
+}
+
+// RemoveOrderItem refuses to remove the last line; guests cancel the order
+// instead. Like quantity changes, it only works for lines the kitchen has not
+// started on.
+func RemoveOrderItem(w http.ResponseWriter, r *http.Request) {
+	itemID := mux.Vars(r)["item_id"]
+	editOrderItems(w, r, func(tx *gorm.DB, order *models.Order) (dto.OrderItemsDiff, error) {
+		diff := dto.OrderItemsDiff{}
+		i, err := findOrderLine(order.OrderFood, itemID)
+		if err != nil {
+			return diff, err
+		}
+		if len(order.OrderFood) == 1 {
+			return diff, &orderError{http.StatusConflict, "Cannot remove the last item", "Cancel the order instead"}
+		}
+		line := order.OrderFood[i]
+		if line.Status != models.DishQueued {
+			return diff, &orderError{http.StatusConflict, "Item is already being prepared", fmt.Sprintf("The item is %s", line.Status)}
+		}
+		if err := tx.Delete(&line).Error; err != nil {
+			return diff, err
+		}
+		order.OrderFood = append(order.OrderFood[:i], order.OrderFood[i+1:]...)
+		diff.Removed = append(diff.Removed, dto.NewOrderFood(line))
+		return diff, nil
+	})
+}
@@ -0,0 +1,238 @@
+package views
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultOrderPageSize = 50
+	maxOrderPageSize     = 200
+)
+
+type orderSort struct {
+	column  string
+	desc    bool
+	byTotal bool
+}
+
+// orderSorts are the values of ?sort=. Ties are broken by order ID in the
+// same direction, so cursors never skip or repeat an order.
+var orderSorts = map[string]orderSort{
+	"newest":     {column: "orders.created_at", desc: true},
+	"oldest":     {column: "orders.created_at"},
+	"total_desc": {column: "orders.total", desc: true, byTotal: true},
+	"total_asc":  {column: "orders.total", byTotal: true},
+}
+
+// orderCursor points just past the last order of a page. It remembers the
+// sort it was issued for and is rejected with any other.
+type orderCursor struct {
+	Sort      string    `json:"s"`
+	CreatedAt time.Time `json:"c"`
+	Total     uint      `json:"t"`
+	ID        string    `json:"i"`
+}
+
+func (c orderCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeOrderCursor(value string) (orderCursor, error) {
+	var cursor orderCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	return cursor, json.Unmarshal(raw, &cursor)
+}
+
+// orderQuery is the filter, sort and page of an order listing, shared by the
+// order list, the staff board and the XLSX export. Its conditions name the
+// orders table, so it also works on queries that join it.
+type orderQuery struct {
+	Statuses []models.OrderStatus
+	TableID  string
+	StaffID  string
+	From, To *time.Time
+	MinTotal *uint
+	MaxTotal *uint
+	Sequence *int
+	SortName string
+	Sort     orderSort
+	Cursor   *orderCursor
+	Limit    int
+}
+
+// parseOrderQuery reads the listing parameters:
+//
+//	status      comma-separated statuses
+//	table_id    the table
+//	staff_id    the waiter who received the order
+//	from, to    first and last business day, YYYY-MM-DD
+//	min_total   smallest total in so'm
+//	max_total   largest total in so'm
+//	number      the order number, as printed or just the digits
+//	sort        newest (default), oldest, total_desc or total_asc
+//	cursor      next_cursor of the previous page
+//	limit       page size, at most maxOrderPageSize
+func parseOrderQuery(values url.Values) (orderQuery, error) {
+	q := orderQuery{SortName: "newest", Limit: defaultOrderPageSize}
+	if statuses := values.Get("status"); statuses != "" {
+		for _, status := range strings.Split(statuses, ",") {
+			status := models.OrderStatus(strings.TrimSpace(status))
+			if !slices.Contains(models.OrderStatuses, status) {
+				return q, fmt.Errorf("unknown status %q", status)
+			}
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+	q.TableID = values.Get("table_id")
+	q.StaffID = values.Get("staff_id")
+	var err error
+	if q.From, err = parseOrderDay(values, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseOrderDay(values, "to"); err != nil {
+		return q, err
+	}
+	if q.MinTotal, err = parseOrderTotal(values, "min_total"); err != nil {
+		return q, err
+	}
+	if q.MaxTotal, err = parseOrderTotal(values, "max_total"); err != nil {
+		return q, err
+	}
+	if number := values.Get("number"); number != "" {
+		sequence, err := orderNumbers.Sequence(number)
+		if err != nil {
+			return q, err
+		}
+		q.Sequence = &sequence
+	}
+	if name := values.Get("sort"); name != "" {
+		q.SortName = name
+	}
+	sort, ok := orderSorts[q.SortName]
+	if !ok {
+		return q, fmt.Errorf("unknown sort %q", q.SortName)
+	}
+	q.Sort = sort
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := decodeOrderCursor(value)
+		if err != nil || cursor.ID == "" {
+			return q, fmt.Errorf("invalid cursor")
+		}
+		if cursor.Sort != q.SortName {
+			return q, fmt.Errorf("the cursor was issued for sort %q", cursor.Sort)
+		}
+		q.Cursor = &cursor
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxOrderPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxOrderPageSize)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+func parseOrderDay(values url.Values, name string) (*time.Time, error) {
+	value := values.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date like 2006-01-02", name)
+	}
+	return &day, nil
+}
+
+func parseOrderTotal(values url.Values, name string) (*uint, error) {
+	value := values.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	total, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a whole number of so'm", name)
+	}
+	amount := uint(total)
+	return &amount, nil
+}
+
+func (q orderQuery) filter(db *gorm.DB) *gorm.DB {
+	if len(q.Statuses) > 0 {
+		db = db.Where("orders.status IN ?", q.Statuses)
+	}
+	if q.TableID != "" {
+		db = db.Where("orders.table_id = ?", q.TableID)
+	}
+	if q.StaffID != "" {
+		db = db.Where("orders.user_id = ?", q.StaffID)
+	}
+	if q.From != nil {
+		db = db.Where("orders.business_day >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("orders.business_day <= ?", *q.To)
+	}
+	if q.MinTotal != nil {
+		db = db.Where("orders.total >= ?", *q.MinTotal)
+	}
+	if q.MaxTotal != nil {
+		db = db.Where("orders.total <= ?", *q.MaxTotal)
+	}
+	if q.Sequence != nil {
+		db = db.Where("orders.sequence = ?", *q.Sequence)
+	}
+	return db
+}
+
+func (q orderQuery) order(db *gorm.DB) *gorm.DB {
+	return db.
+		Order(clause.OrderByColumn{Column: clause.Column{Name: q.Sort.column, Raw: true}, Desc: q.Sort.desc}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "orders.id", Raw: true}, Desc: q.Sort.desc})
+}
+
+// page limits db to the page after the cursor, fetching one extra order so
+// nextCursor can tell whether another page follows.
+func (q orderQuery) page(db *gorm.DB) *gorm.DB {
+	db = q.order(q.filter(db))
+	if q.Cursor != nil {
+		var key any = q.Cursor.CreatedAt
+		if q.Sort.byTotal {
+			key = q.Cursor.Total
+		}
+		op := ">"
+		if q.Sort.desc {
+			op = "<"
+		}
+		db = db.Where(fmt.Sprintf("(%s, orders.id) %s (?, ?)", q.Sort.column, op), key, q.Cursor.ID)
+	}
+	return db.Limit(q.Limit + 1)
+}
+
+// nextCursor trims the extra order fetched by page and returns the cursor of
+// the following page, or "" if this is the last one.
+func (q orderQuery) nextCursor(orders []models.Order) ([]models.Order, string) {
+	if len(orders) <= q.Limit {
+		return orders, ""
+	}
+	orders = orders[:q.Limit]
+	last := orders[len(orders)-1]
+	cursor := orderCursor{Sort: q.SortName, CreatedAt: last.CreatedAt, Total: last.Total, ID: last.ID}
+	return orders, cursor.encode()
+}
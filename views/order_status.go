@@ -0,0 +1,230 @@
+package views
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// orderCancelGrace is how long guests can cancel an order they placed.
+var orderCancelGrace = 2 * time.Minute
+
+// orderNumbers formats the per-business-day order numbers.
+var orderNumbers = &utils.OrderNumbering{Prefix: "#", Format: "%04d", DayStart: 4 * time.Hour}
+
+// InitOrders reads ORDER_CANCEL_GRACE, which defaults to 2m,
+// IDEMPOTENCY_TTL, which defaults to 24h, and the order number settings
+// described at utils.NewOrderNumberingFromEnv.
+func InitOrders() error {
+	grace, err := time.ParseDuration(cmp.Or(utils.GetEnv("ORDER_CANCEL_GRACE"), "2m"))
+	if err != nil {
+		return fmt.Errorf("ORDER_CANCEL_GRACE: %w", err)
+	}
+	ttl, err := time.ParseDuration(cmp.Or(utils.GetEnv("IDEMPOTENCY_TTL"), "24h"))
+	if err != nil {
+		return fmt.Errorf("IDEMPOTENCY_TTL: %w", err)
+	}
+	numbers, err := utils.NewOrderNumberingFromEnv()
+	if err != nil {
+		return err
+	}
+	orderCancelGrace = grace
+	idempotencyTTL = ttl
+	orderNumbers = numbers
+	return nil
+}
+
+// orderError carries the HTTP status a refused order change is reported
+// with.
+type orderError struct {
+	status  int
+	message string
+	detail  string
+}
+
+func (e *orderError) Error() string {
+	return e.message + ": " + e.detail
+}
+
+// transitionOrder moves the order to status "to" if the state machine in
+// models.OrderTransitions allows it for the acting user, and assigns an
+// unassigned order to the user. The order must have been loaded with a row
+// lock in tx.
+func transitionOrder(tx *gorm.DB, r *http.Request, order *models.Order, to models.OrderStatus, reason models.CancelReason) error {
+	from := order.Status
+	transition, ok := models.FindOrderTransition(from, to)
+	if !ok {
+		return &orderError{http.StatusConflict, "Invalid status transition", fmt.Sprintf("An order cannot go from %q to %q", from, to)}
+	}
+	if !middleware.HasPermission(r.Context(), transition.Permission) {
+		return &orderError{http.StatusForbidden, "Forbidden", fmt.Sprintf("Permission %q is required", transition.Permission)}
+	}
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	if transition.AssigneeOnly && order.UserID != nil && *order.UserID != userID {
+		return &orderError{http.StatusForbidden, "Order is assigned to someone else", "Only the assigned staff member can change its status"}
+	}
+	if to.NeedsReason() && !reason.ValidForStaff() {
+		return &orderError{http.StatusBadRequest, "A reason is required", fmt.Sprintf("Reason must be one of %v", models.StaffCancelReasons)}
+	}
+	if !to.NeedsReason() {
+		reason = ""
+	}
+	if to == models.OrderPaid {
+		covered, err := orderCovered(tx, order)
+		if err != nil {
+			return err
+		}
+		if !covered {
+			return &orderError{http.StatusConflict, "Order is not paid", "Record and confirm its payments first"}
+		}
+	}
+	if order.UserID == nil && !to.Final() {
+		order.UserID = &userID
+	}
+	return setOrderStatus(tx, r, order, to, reason, &userID)
+}
+
+// setOrderStatus saves the new status and records it in the status history
+// and the audit log. Callers check that the change is allowed. An order that
+// is served after it was paid for goes on to paid.
+func setOrderStatus(tx *gorm.DB, r *http.Request, order *models.Order, to models.OrderStatus, reason models.CancelReason, actorID *string) error {
+	from := order.Status
+	before := dto.NewOrder(*order)
+	order.Status = to
+	order.CancelReason = reason
+	if err := tx.Model(order).Select("status", "cancel_reason", "user_id").Updates(order).Error; err != nil {
+		return err
+	}
+	if err := models.RecordOrderStatusWithReason(tx, order.ID, from, to, reason, actorID); err != nil {
+		return err
+	}
+	if err := catchUpDishes(tx, order.ID, to); err != nil {
+		return err
+	}
+	if err := audit(tx, r, models.AuditUpdate, "order", order.ID, before, dto.NewOrder(*order)); err != nil {
+		return err
+	}
+	if to != models.OrderServed || order.Total == 0 {
+		return nil
+	}
+	covered, err := orderCovered(tx, order)
+	if err != nil || !covered {
+		return err
+	}
+	return setOrderStatus(tx, r, order, models.OrderPaid, "", actorID)
+}
+
+// changeOrderStatus runs transitionOrder for the order in the URL and tells
+// the table and the staff about the new status.
+func changeOrderStatus(w http.ResponseWriter, r *http.Request, to models.OrderStatus, reason models.CancelReason) {
+	vars := mux.Vars(r)
+	var order models.Order
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "ID = ?", vars["id"]).Error; err != nil {
+			return err
+		}
+		return transitionOrder(tx, r, &order, to, reason)
+	})
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found", err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to update order status", err.Error())
+		return
+	}
+	models.DB.Preload("Table").First(&order, "ID = ?", order.ID)
+	broadcastOrder("status_updated", order)
+	utils.RespondWithSuccess(w, http.StatusOK, "Status updated", dto.NewOrder(order))
+}
+
+func broadcastOrder(event string, order models.Order) {
+	message := utils.WebSocketMessage{Event: event, Data: dto.NewOrder(order)}
+	broadcastToGuests(message, order)
+	HubInstance.BroadcastToRoom(staffRoom, message)
+}
+
+// UpdateOrderStatus is the generic transition endpoint. Which user may make
+// which transition is decided by models.OrderTransitions.
+func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	var input dto.OrderStatusInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if !input.Status.Valid() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", fmt.Sprintf("Unknown status %q", input.Status))
+		return
+	}
+	changeOrderStatus(w, r, input.Status, input.Reason)
+}
+
+// ReceiveOrder claims a pending order for the current user.
+func ReceiveOrder(w http.ResponseWriter, r *http.Request) {
+	changeOrderStatus(w, r, models.OrderAccepted, "")
+}
+
+// CancelOrderByGuest lets guests cancel a pending order placed from their
+// table session within orderCancelGrace of placing it.
+func CancelOrderByGuest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionID, _ := r.Context().Value(middleware.TableSessionIDKey).(string)
+	var order models.Order
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&order, "ID = ? AND table_session_id = ?", vars["id"], sessionID).Error; err != nil {
+			return err
+		}
+		if order.Status != models.OrderPending {
+			return &orderError{http.StatusConflict, "Order can no longer be cancelled", "The restaurant has already accepted it"}
+		}
+		if time.Since(order.CreatedAt) > orderCancelGrace {
+			return &orderError{http.StatusConflict, "Order can no longer be cancelled", fmt.Sprintf("Orders can only be cancelled within %s of placing them", orderCancelGrace)}
+		}
+		return setOrderStatus(tx, r, &order, models.OrderCancelled, models.CancelGuestRequest, nil)
+	})
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Order not found", err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to cancel order", err.Error())
+		return
+	}
+	models.DB.Preload("Table").First(&order, "ID = ?", order.ID)
+	broadcastOrder("status_updated", order)
+	utils.RespondWithSuccess(w, http.StatusOK, "Order cancelled", dto.NewOrder(order))
+}
+
+func GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var history []models.OrderStatusHistory
+	if dbResult := models.DB.Preload("Actor").Where("order_id = ?", vars["id"]).Order("created_at").Find(&history); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewOrderStatusHistoryList(history))
+}
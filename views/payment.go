@@ -0,0 +1,449 @@
+package views
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/payments"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// outstanding is what of total is neither paid nor being paid.
+func outstanding(tx *gorm.DB, total uint, of models.Payment) (uint, error) {
+	confirmed, pending, err := models.PaidAmounts(tx, of)
+	if err != nil || confirmed+pending >= total {
+		return 0, err
+	}
+	return total - confirmed - pending, nil
+}
+
+// payableOrder locks the order and checks it is paid directly, not through
+// the bills of a split.
+func payableOrder(tx *gorm.DB, orderID string) (models.Order, error) {
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "ID = ?", orderID).Error; err != nil {
+		return order, err
+	}
+	switch order.Status {
+	case models.OrderCancelled, models.OrderRejected, models.OrderPaid:
+		return order, &orderError{http.StatusConflict, "Order cannot be paid", fmt.Sprintf("The order is %s", order.Status)}
+	}
+	splitID, err := models.ActiveSplitOf(tx, order.ID)
+	if err != nil {
+		return order, err
+	}
+	if splitID != "" {
+		return order, &orderError{http.StatusConflict, "Order is split", fmt.Sprintf("Pay the bills of split %s instead", splitID)}
+	}
+	return order, nil
+}
+
+// payableBill locks the split the bill belongs to and checks it is active.
+func payableBill(tx *gorm.DB, billID string) (models.Bill, error) {
+	var bill models.Bill
+	if err := tx.First(&bill, "ID = ?", billID).Error; err != nil {
+		return bill, err
+	}
+	var split models.BillSplit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&split, "ID = ?", bill.SplitID).Error; err != nil {
+		return bill, err
+	}
+	if split.CancelledAt != nil {
+		return bill, &orderError{http.StatusConflict, "Bill cannot be paid", "Its split was cancelled"}
+	}
+	bill.Split = &split
+	return bill, nil
+}
+
+// settlePayment records the outcome of a pending payment, together with the
+// provider reference and pay URL set on payment, and reloads payment. It
+// returns the orders the payment completed: an order paid directly becomes
+// paid once it is served and covered, and the orders of a split once every
+// bill is covered.
+func settlePayment(tx *gorm.DB, r *http.Request, payment *models.Payment, status payments.Status, actorID *string) ([]models.Order, error) {
+	var current models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, "ID = ?", payment.ID).Error; err != nil {
+		return nil, err
+	}
+	if current.Status.Final() {
+		*payment = current
+		return nil, &orderError{http.StatusConflict, "Payment is already settled", fmt.Sprintf("The payment is %s", current.Status)}
+	}
+	before := dto.NewPayment(current)
+	current.ProviderRef = cmp.Or(payment.ProviderRef, current.ProviderRef)
+	current.PayURL = cmp.Or(payment.PayURL, current.PayURL)
+	*payment = current
+	now := time.Now()
+	payment.Status = status
+	if status.Final() {
+		payment.SettledAt = &now
+	}
+	if err := tx.Model(payment).Select("status", "provider_ref", "pay_url", "settled_at").Updates(payment).Error; err != nil {
+		return nil, err
+	}
+	if err := audit(tx, r, models.AuditUpdate, "payment", payment.ID, before, dto.NewPayment(*payment)); err != nil {
+		return nil, err
+	}
+	if status != payments.StatusConfirmed {
+		return nil, nil
+	}
+	if payment.BillID != nil {
+		return settleSplit(tx, r, *payment.BillID, actorID)
+	}
+	order, err := payableOrder(tx, *payment.OrderID)
+	var refused *orderError
+	if errors.As(err, &refused) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	confirmed, _, err := models.PaidAmounts(tx, models.Payment{OrderID: &order.ID})
+	if err != nil || order.Status != models.OrderServed || confirmed < order.Total {
+		return nil, err
+	}
+	return []models.Order{order}, setOrderStatus(tx, r, &order, models.OrderPaid, "", actorID)
+}
+
+// settleSplit marks the served orders of the bill's split paid when every
+// bill of the split is covered.
+func settleSplit(tx *gorm.DB, r *http.Request, billID string, actorID *string) ([]models.Order, error) {
+	bill, err := payableBill(tx, billID)
+	if err != nil {
+		return nil, err
+	}
+	settled, err := splitSettled(tx, bill.SplitID)
+	if err != nil || !settled {
+		return nil, err
+	}
+	var orders []models.Order
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN (?)", tx.Table("bill_split_orders").Select("order_id").Where("bill_split_id = ?", bill.SplitID)).
+		Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+	var paid []models.Order
+	for i := range orders {
+		if orders[i].Status != models.OrderServed {
+			continue
+		}
+		if err := setOrderStatus(tx, r, &orders[i], models.OrderPaid, "", actorID); err != nil {
+			return nil, err
+		}
+		paid = append(paid, orders[i])
+	}
+	return paid, nil
+}
+
+// orderCovered reports whether confirmed payments cover the order: the
+// bills of its active split, or else the order's own payments.
+func orderCovered(tx *gorm.DB, order *models.Order) (bool, error) {
+	splitID, err := models.ActiveSplitOf(tx, order.ID)
+	if err != nil {
+		return false, err
+	}
+	if splitID != "" {
+		return splitSettled(tx, splitID)
+	}
+	confirmed, _, err := models.PaidAmounts(tx, models.Payment{OrderID: &order.ID})
+	return confirmed >= order.Total, err
+}
+
+func splitSettled(tx *gorm.DB, splitID string) (bool, error) {
+	var bills []models.Bill
+	if err := tx.Where("split_id = ?", splitID).Find(&bills).Error; err != nil {
+		return false, err
+	}
+	for _, bill := range bills {
+		confirmed, _, err := models.PaidAmounts(tx, models.Payment{BillID: &bill.ID})
+		if err != nil || confirmed < bill.Amount {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// respondPayment tells the guests of the paid orders and the staff about the
+// payment and about the orders it completed.
+func respondPayment(w http.ResponseWriter, status int, message string, payment models.Payment, paid []models.Order) {
+	var orders []models.Order
+	if payment.OrderID != nil {
+		models.DB.Select("id", "table_session_id").Where("id = ?", *payment.OrderID).Find(&orders)
+	} else if payment.BillID != nil {
+		models.DB.Select("orders.id", "orders.table_session_id").
+			Joins("JOIN bill_split_orders ON bill_split_orders.order_id = orders.id").
+			Joins("JOIN bills ON bills.split_id = bill_split_orders.bill_split_id").
+			Where("bills.id = ?", *payment.BillID).
+			Find(&orders)
+	}
+	event := utils.WebSocketMessage{Event: "payment_updated", Data: dto.NewPayment(payment)}
+	broadcastToGuests(event, orders...)
+	HubInstance.BroadcastToRoom(staffRoom, event)
+	for _, order := range paid {
+		models.DB.Preload("Table").First(&order, "ID = ?", order.ID)
+		broadcastOrder("status_updated", order)
+	}
+	if w != nil {
+		utils.RespondWithSuccess(w, status, message, dto.NewPayment(payment))
+	}
+}
+
+func respondPaymentError(w http.ResponseWriter, err error, action string) {
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Not found", err.Error())
+	default:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to "+action, err.Error())
+	}
+}
+
+// initiatePayment starts a payment. reserve locks what is paid for, points
+// the payment at it, and returns its description and the amount left to pay.
+// Several payments, with different methods, can share an order or bill until
+// they cover it. Wallet payments stay pending until the provider's callback
+// or a confirmation.
+func initiatePayment(w http.ResponseWriter, r *http.Request, reserve func(tx *gorm.DB, payment *models.Payment) (string, uint, error)) {
+	var input dto.PaymentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if !input.Method.Valid() {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", fmt.Sprintf("Method must be one of %v", payments.Methods))
+		return
+	}
+	provider, err := payments.For(input.Method)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Payment method unavailable", err.Error())
+		return
+	}
+	actorID, _ := r.Context().Value(middleware.UserIDKey).(string)
+
+	var description string
+	payment := models.Payment{Method: input.Method, Provider: provider.Name(), Status: payments.StatusPending, ActorID: &actorID}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var left uint
+		var err error
+		if description, left, err = reserve(tx, &payment); err != nil {
+			return err
+		}
+		payment.Amount = input.Amount
+		if payment.Amount == 0 {
+			payment.Amount = left
+		}
+		if payment.Amount == 0 || payment.Amount > left {
+			return &orderError{http.StatusConflict, "Invalid amount", fmt.Sprintf("%d so'm is left to pay", left)}
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "payment", payment.ID, nil, dto.NewPayment(payment))
+	})
+	if err != nil {
+		respondPaymentError(w, err, "create payment")
+		return
+	}
+
+	// The provider is called outside the transaction so a slow provider does
+	// not keep the order locked; the pending payment already holds the amount.
+	initiation, err := provider.Initiate(r.Context(), payments.Request{
+		PaymentID:   payment.ID,
+		Amount:      payment.Amount,
+		Description: description,
+		CallbackURL: payments.CallbackURL(provider),
+	})
+	status := initiation.Status
+	if err != nil {
+		status = payments.StatusFailed
+	}
+	payment.ProviderRef = initiation.Reference
+	payment.PayURL = initiation.PayURL
+	var paid []models.Order
+	settleErr := models.DB.Transaction(func(tx *gorm.DB) error {
+		if status == payments.StatusPending {
+			return tx.Model(&payment).Select("provider_ref", "pay_url").Updates(&payment).Error
+		}
+		var err error
+		paid, err = settlePayment(tx, r, &payment, status, &actorID)
+		return err
+	})
+	if err != nil {
+		respondPayment(nil, 0, "", payment, nil)
+		utils.RespondWithError(w, http.StatusBadGateway, "Payment provider failed", err.Error())
+		return
+	}
+	if settleErr != nil {
+		respondPaymentError(w, settleErr, "record payment")
+		return
+	}
+	respondPayment(w, http.StatusCreated, "Payment started", payment, paid)
+}
+
+// InitiatePayment starts a payment towards an order that is not split.
+func InitiatePayment(w http.ResponseWriter, r *http.Request) {
+	initiatePayment(w, r, func(tx *gorm.DB, payment *models.Payment) (string, uint, error) {
+		order, err := payableOrder(tx, mux.Vars(r)["id"])
+		if err != nil {
+			return "", 0, err
+		}
+		payment.OrderID = &order.ID
+		left, err := outstanding(tx, order.Total, models.Payment{OrderID: &order.ID})
+		return "Order " + order.OrderId, left, err
+	})
+}
+
+// InitiateBillPayment starts a payment towards one bill of a split.
+func InitiateBillPayment(w http.ResponseWriter, r *http.Request) {
+	initiatePayment(w, r, func(tx *gorm.DB, payment *models.Payment) (string, uint, error) {
+		bill, err := payableBill(tx, mux.Vars(r)["id"])
+		if err != nil {
+			return "", 0, err
+		}
+		payment.BillID = &bill.ID
+		left, err := outstanding(tx, bill.Amount, models.Payment{BillID: &bill.ID})
+		return cmp.Or(bill.Label, "Bill"), left, err
+	})
+}
+
+// ConfirmPayment asks the provider how a pending payment went. For card
+// payments it is staff confirming the terminal slip.
+func ConfirmPayment(w http.ResponseWriter, r *http.Request) {
+	var input dto.ConfirmPaymentInput
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+			return
+		}
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	var payment models.Payment
+	if err := models.DB.First(&payment, "ID = ?", mux.Vars(r)["id"]).Error; err != nil {
+		respondPaymentError(w, err, "get payment")
+		return
+	}
+	if payment.Status.Final() {
+		utils.RespondWithError(w, http.StatusConflict, "Payment is already settled", fmt.Sprintf("The payment is %s", payment.Status))
+		return
+	}
+	provider, err := payments.For(payment.Method)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Payment method unavailable", err.Error())
+		return
+	}
+	status, err := provider.Status(r.Context(), payment.ProviderRef)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadGateway, "Payment provider failed", err.Error())
+		return
+	}
+	if status == payments.StatusPending {
+		utils.RespondWithSuccess(w, http.StatusAccepted, "Payment is still pending", dto.NewPayment(payment))
+		return
+	}
+	if payment.ProviderRef == "" {
+		payment.ProviderRef = input.Reference
+	}
+	actorID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	var paid []models.Order
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		paid, err = settlePayment(tx, r, &payment, status, &actorID)
+		return err
+	})
+	if err != nil {
+		respondPaymentError(w, err, "confirm payment")
+		return
+	}
+	respondPayment(w, http.StatusOK, "Payment "+string(payment.Status), payment, paid)
+}
+
+// CancelPayment drops a pending payment, for example when the guest pays
+// another way after all.
+func CancelPayment(w http.ResponseWriter, r *http.Request) {
+	payment := models.Payment{ID: mux.Vars(r)["id"]}
+	actorID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := settlePayment(tx, r, &payment, payments.StatusCancelled, &actorID)
+		return err
+	})
+	if err != nil {
+		respondPaymentError(w, err, "cancel payment")
+		return
+	}
+	respondPayment(w, http.StatusOK, "Payment cancelled", payment, nil)
+}
+
+// PaymentCallback receives the outcome of a payment from its provider. The
+// provider authenticates the request itself.
+func PaymentCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := payments.Named(mux.Vars(r)["provider"])
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Unknown payment provider", nil)
+		return
+	}
+	callback, err := provider.Callback(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid callback", err.Error())
+		return
+	}
+	if callback.Status == payments.StatusPending {
+		utils.RespondWithSuccess(w, http.StatusOK, "OK", nil)
+		return
+	}
+	var payment models.Payment
+	if err := models.DB.First(&payment, "provider = ? AND provider_ref = ?", provider.Name(), callback.Reference).Error; err != nil {
+		respondPaymentError(w, err, "get payment")
+		return
+	}
+	var paid []models.Order
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		paid, err = settlePayment(tx, r, &payment, callback.Status, nil)
+		return err
+	})
+	var refused *orderError
+	if errors.As(err, &refused) {
+		// Providers repeat callbacks until they are acknowledged.
+		utils.RespondWithSuccess(w, http.StatusOK, "Already settled", nil)
+		return
+	}
+	if err != nil {
+		respondPaymentError(w, err, "record payment")
+		return
+	}
+	respondPayment(w, http.StatusOK, "OK", payment, paid)
+}
+
+func GetOrderPayments(w http.ResponseWriter, r *http.Request) {
+	var order models.Order
+	if err := models.DB.First(&order, "ID = ?", mux.Vars(r)["id"]).Error; err != nil {
+		respondPaymentError(w, err, "get order")
+		return
+	}
+	var list []models.Payment
+	if err := models.DB.Where("order_id = ?", order.ID).Order("created_at").Find(&list).Error; err != nil {
+		respondPaymentError(w, err, "get payments")
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewPayments(order.Total, list))
+}
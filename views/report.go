@@ -0,0 +1,75 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+)
+
+// cancellations loads the cancel and reject entries of the status history,
+// optionally limited to the from and to dates of the query string.
+func cancellations(r *http.Request) ([]models.OrderStatusHistory, error) {
+	query := r.URL.Query()
+	db := models.DB.
+		Preload("Order.Table").
+		Preload("Actor").
+		Where(map[string]any{"to": []models.OrderStatus{models.OrderCancelled, models.OrderRejected}})
+	if from, err := time.Parse(time.DateOnly, query.Get("from")); err == nil {
+		db = db.Where("created_at >= ?", from)
+	}
+	if to, err := time.Parse(time.DateOnly, query.Get("to")); err == nil {
+		db = db.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+	var history []models.OrderStatusHistory
+	err := db.Order("created_at DESC").Find(&history).Error
+	return history, err
+}
+
+func GetCancellationReport(w http.ResponseWriter, r *http.Request) {
+	history, err := cancellations(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewCancellationReport(history))
+}
+
+func DownloadCancellationExcel(w http.ResponseWriter, r *http.Request) {
+	history, err := cancellations(r)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch data", err.Error())
+		return
+	}
+
+	exporter := utils.NewTaomExcelExporter()
+	headers := []string{"Vaqt", "Buyurtma raqami", "Stol raqami", "Holat", "Sabab", "Summa (so'm)", "Xodim"}
+	exporter.SetHeaders(headers)
+
+	var rows [][]any
+	for _, item := range dto.NewCancellationReport(history).Items {
+		rows = append(rows, []any{
+			item.CancelledAt.Format("2006-01-02 15:04"),
+			item.OrderNumber,
+			item.TableNumber,
+			item.Status,
+			item.Reason,
+			item.Total,
+			item.ActorLogin,
+		})
+	}
+	exporter.SetRows(rows)
+
+	buf, err := exporter.Generate()
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate Excel file", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="cancellations.xlsx"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,157 @@
+package views
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func rolePermissions(codes []string) ([]models.Permission, error) {
+	permissions := make([]models.Permission, 0, len(codes))
+	for _, code := range codes {
+		if !models.IsPermission(code) {
+			return nil, fmt.Errorf("unknown permission %q", code)
+		}
+		permissions = append(permissions, models.Permission{Code: code})
+	}
+	return permissions, nil
+}
+
+func GetPermissions(w http.ResponseWriter, r *http.Request) {
+	var permissions []models.Permission
+	if dbResult := models.DB.Order("code").Find(&permissions); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewPermissionList(permissions))
+}
+func CreateRole(w http.ResponseWriter, r *http.Request) {
+	var request dto.RoleInput
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	permissions, err := rolePermissions(request.Permissions)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	role := models.Role{Name: request.Name, Permissions: permissions}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions.*").Create(&role).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "role", role.ID, nil, dto.NewRole(role))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Role already exists", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusCreated, "Role created successfully", dto.NewRole(role))
+}
+func GetRoles(w http.ResponseWriter, r *http.Request) {
+	var roles []models.Role
+	if dbResult := models.DB.Preload("Permissions").Order("created_at").Find(&roles); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewRoleList(roles))
+}
+func GetRole(w http.ResponseWriter, r *http.Request) {
+	var role models.Role
+	vars := mux.Vars(r)
+	roleID := vars["id"]
+	if dbResult := models.DB.Preload("Permissions").Where("ID = ?", roleID).First(&role); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Role not found", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewRole(role))
+}
+func UpdateRole(w http.ResponseWriter, r *http.Request) {
+	var role models.Role
+	vars := mux.Vars(r)
+	roleID := vars["id"]
+	if dbResult := models.DB.Preload("Permissions").Where("ID = ?", roleID).First(&role); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Role not found", dbResult.Error.Error())
+		return
+	}
+	if role.Name == models.AdminRoleName {
+		utils.RespondWithError(w, http.StatusBadRequest, "The admin role cannot be changed", nil)
+		return
+	}
+	var request dto.RoleInput
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	permissions, err := rolePermissions(request.Permissions)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if role.System && request.Name != role.Name {
+		utils.RespondWithError(w, http.StatusBadRequest, "Built-in roles cannot be renamed", nil)
+		return
+	}
+	before := dto.NewRole(role)
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		role.Name = request.Name
+		if err := tx.Omit("Permissions").Save(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+		role.Permissions = permissions
+		return audit(tx, r, models.AuditUpdate, "role", role.ID, before, dto.NewRole(role))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Role updated successfully", dto.NewRole(role))
+}
+func DeleteRole(w http.ResponseWriter, r *http.Request) {
+	var role models.Role
+	vars := mux.Vars(r)
+	roleID := vars["id"]
+	if dbResult := models.DB.Preload("Permissions").Where("ID = ?", roleID).First(&role); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Role not found", dbResult.Error.Error())
+		return
+	}
+	if role.System {
+		utils.RespondWithError(w, http.StatusBadRequest, "Built-in roles cannot be deleted", nil)
+		return
+	}
+	var users int64
+	models.DB.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&users)
+	if users > 0 {
+		utils.RespondWithError(w, http.StatusConflict, "Role is still assigned to staff", fmt.Sprintf("%d users have this role", users))
+		return
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("Permissions").Delete(&role).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditDelete, "role", role.ID, dto.NewRole(role), nil)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Role deleted successfully", nil)
+}
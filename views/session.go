@@ -0,0 +1,212 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errRefreshReused = errors.New("refresh token reuse detected")
+
+func signAccessToken(session *models.Session) (string, error) {
+	return utils.Tokens.Sign(&utils.Claims{UserID: session.UserID, SessionID: session.ID})
+}
+
+func openSession(r *http.Request, userID string) (dto.TokenResponse, error) {
+	refreshToken, err := utils.RandomToken()
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:           userID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        r.UserAgent(),
+		IP:               utils.ClientIP(r),
+		ExpiresAt:        now.Add(utils.Tokens.RefreshTTL()),
+		LastUsedAt:       now,
+	}
+	// Rotated-away tokens only matter while their session can be refreshed.
+	ended := models.DB.Model(&models.Session{}).Select("id").
+		Where("user_id = ? AND (revoked_at IS NOT NULL OR expires_at <= ?)", userID, now)
+	if err := models.DB.Where("session_id IN (?)", ended).Delete(&models.UsedRefreshToken{}).Error; err != nil {
+		return dto.TokenResponse{}, err
+	}
+	if err := models.DB.Create(&session).Error; err != nil {
+		return dto.TokenResponse{}, err
+	}
+	token, err := signAccessToken(&session)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	return dto.TokenResponse{Token: token, RefreshToken: refreshToken, ExpiresIn: int64(utils.Tokens.TTL().Seconds())}, nil
+}
+
+// rotateSession swaps the refresh token of the session it belongs to. Any
+// token that was already rotated away means it leaked, so its session is
+// revoked. Rotating extends the session by the refresh TTL, but never past
+// the maximum age counted from the login.
+func rotateSession(r *http.Request, refreshToken string) (dto.TokenResponse, error) {
+	hash := utils.HashToken(refreshToken)
+	newRefreshToken, err := utils.RandomToken()
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	var session models.Session
+	reused := false
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			// The revocation must be committed, so reuse is reported after
+			// the transaction rather than by rolling it back.
+			used := tx.Model(&models.UsedRefreshToken{}).Select("session_id").Where("hash = ?", hash)
+			dbResult := tx.Model(&models.Session{}).
+				Where("ID IN (?) AND revoked_at IS NULL", used).
+				Update("revoked_at", time.Now())
+			if dbResult.Error != nil {
+				return dbResult.Error
+			}
+			reused = dbResult.RowsAffected > 0
+			if reused {
+				return nil
+			}
+			return middleware.ErrSessionRevoked
+		}
+		now := time.Now()
+		if !session.Active(now) {
+			return middleware.ErrSessionRevoked
+		}
+		var user models.User
+		if err := tx.Select("active").Where("ID = ?", session.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		if !user.Active {
+			return middleware.ErrUserInactive
+		}
+		if err := tx.Create(&models.UsedRefreshToken{Hash: session.RefreshTokenHash, SessionID: session.ID}).Error; err != nil {
+			return err
+		}
+		session.RefreshTokenHash = utils.HashToken(newRefreshToken)
+		session.ExpiresAt = now.Add(utils.Tokens.RefreshTTL())
+		if limit := session.CreatedAt.Add(utils.Tokens.SessionMaxAge()); session.ExpiresAt.After(limit) {
+			session.ExpiresAt = limit
+		}
+		session.LastUsedAt = now
+		session.UserAgent = r.UserAgent()
+		session.IP = utils.ClientIP(r)
+		return tx.Save(&session).Error
+	})
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	if reused {
+		return dto.TokenResponse{}, errRefreshReused
+	}
+	token, err := signAccessToken(&session)
+	if err != nil {
+		return dto.TokenResponse{}, err
+	}
+	return dto.TokenResponse{Token: token, RefreshToken: newRefreshToken, ExpiresIn: int64(utils.Tokens.TTL().Seconds())}, nil
+}
+
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var request dto.RefreshInput
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(request); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	tokens, err := rotateSession(r, request.RefreshToken)
+	if errors.Is(err, errRefreshReused) {
+		closeEndedSessions()
+	}
+	if errors.Is(err, errRefreshReused) || errors.Is(err, middleware.ErrSessionRevoked) || errors.Is(err, middleware.ErrUserInactive) {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid refresh token", err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to refresh token", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Token refreshed", tokens)
+}
+func Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Context().Value(middleware.SessionIDKey)
+	if dbResult := models.DB.Model(&models.Session{}).Where("ID = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", time.Now()); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+		return
+	}
+	if id, ok := sessionID.(string); ok {
+		HubInstance.CloseRoom(id)
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Logged out", nil)
+}
+func GetStaffSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+	var sessions []models.Session
+	if dbResult := models.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewSessionList(sessions))
+}
+func RevokeStaffSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.RevokeUserSessions(tx, userID); err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "staff", userID, map[string]any{"sessions": "active"}, map[string]any{"sessions": "revoked"})
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	HubInstance.CloseRoom(userID)
+	utils.RespondWithSuccess(w, http.StatusOK, "Sessions revoked", nil)
+}
+func RevokeStaffSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	now := time.Now()
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		dbResult := tx.Model(&models.Session{}).
+			Where("ID = ? AND user_id = ? AND revoked_at IS NULL", vars["session_id"], vars["id"]).
+			Update("revoked_at", now)
+		if dbResult.Error != nil {
+			return dbResult.Error
+		}
+		if dbResult.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return audit(tx, r, models.AuditUpdate, "session", vars["session_id"], map[string]any{"revoked_at": nil}, map[string]any{"revoked_at": now})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.RespondWithError(w, http.StatusNotFound, "Session not found", nil)
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	HubInstance.CloseRoom(vars["session_id"])
+	utils.RespondWithSuccess(w, http.StatusOK, "Session revoked", nil)
+}
@@ -0,0 +1,255 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/payments"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A tab is everything a table ordered during one visit: the orders of its
+// open table session, except cancelled and rejected ones.
+
+func tabOrders(tx *gorm.DB, sessionID string) ([]models.Order, error) {
+	var orders []models.Order
+	err := tx.Preload("OrderFood", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Where("table_session_id = ? AND status NOT IN ?", sessionID, []models.OrderStatus{models.OrderCancelled, models.OrderRejected}).
+		Order("created_at").
+		Find(&orders).Error
+	return orders, err
+}
+
+// tabPaid returns what confirmed payments cover of the orders, directly or
+// through the bills of their active splits.
+func tabPaid(tx *gorm.DB, orders []models.Order) (uint, error) {
+	if len(orders) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	activeBills := tx.Model(&models.Bill{}).
+		Select("bills.id").
+		Joins("JOIN bill_splits ON bill_splits.id = bills.split_id AND bill_splits.cancelled_at IS NULL").
+		Joins("JOIN bill_split_orders ON bill_split_orders.bill_split_id = bill_splits.id").
+		Where("bill_split_orders.order_id IN ?", ids)
+	var paid uint
+	err := tx.Model(&models.Payment{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("status = ? AND (order_id IN ? OR bill_id IN (?))", payments.StatusConfirmed, ids, activeBills).
+		Scan(&paid).Error
+	return paid, err
+}
+
+func loadTab(tx *gorm.DB, session models.TableSession) (dto.TabResponse, error) {
+	orders, err := tabOrders(tx, session.ID)
+	if err != nil {
+		return dto.TabResponse{}, err
+	}
+	paid, err := tabPaid(tx, orders)
+	if err != nil {
+		return dto.TabResponse{}, err
+	}
+	return dto.NewTab(session, orders, paid), nil
+}
+
+func respondTab(w http.ResponseWriter, session models.TableSession) {
+	tab, err := loadTab(models.DB, session)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to get tab", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", tab)
+}
+
+// GetTableTab shows staff the combined orders and totals of a table's visit.
+func GetTableTab(w http.ResponseWriter, r *http.Request) {
+	var session models.TableSession
+	if err := models.DB.Where("table_id = ? AND closed_at IS NULL", mux.Vars(r)["id"]).First(&session).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Table has no open session", err.Error())
+		return
+	}
+	respondTab(w, session)
+}
+
+// GetMyTab shows guests the tab of their table session.
+func GetMyTab(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := r.Context().Value(middleware.TableSessionIDKey).(string)
+	var session models.TableSession
+	if err := models.DB.First(&session, "ID = ?", sessionID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Table session not found", err.Error())
+		return
+	}
+	respondTab(w, session)
+}
+
+// payAtTable records that staff took amount with a cash or card payment at
+// the table.
+func payAtTable(tx *gorm.DB, r *http.Request, payment models.Payment) error {
+	provider, err := payments.For(payment.Method)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	payment.Provider = provider.Name()
+	payment.Status = payments.StatusConfirmed
+	payment.SettledAt = &now
+	if err := tx.Create(&payment).Error; err != nil {
+		return err
+	}
+	return audit(tx, r, models.AuditCreate, "payment", payment.ID, nil, dto.NewPayment(payment))
+}
+
+// settleTab pays whatever the served orders of the tab still owe, directly
+// or on the bills of their splits, with method. Without a method nothing may
+// be owed.
+func settleTab(tx *gorm.DB, r *http.Request, orders []models.Order, method payments.Method, actorID *string) error {
+	var owed uint
+	owe := func(total uint, of models.Payment) error {
+		confirmed, pending, err := models.PaidAmounts(tx, of)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return &orderError{http.StatusConflict, "A payment is still pending", "Confirm or cancel it before closing the tab"}
+		}
+		if confirmed >= total {
+			return nil
+		}
+		owed += total - confirmed
+		if method == "" {
+			return nil
+		}
+		of.Amount = total - confirmed
+		of.Method = method
+		of.ActorID = actorID
+		return payAtTable(tx, r, of)
+	}
+	splits := map[string]bool{}
+	for _, order := range orders {
+		if order.Status == models.OrderPaid {
+			continue
+		}
+		splitID, err := models.ActiveSplitOf(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		if splitID == "" {
+			if err := owe(order.Total, models.Payment{OrderID: &order.ID}); err != nil {
+				return err
+			}
+			continue
+		}
+		if splits[splitID] {
+			continue
+		}
+		splits[splitID] = true
+		var bills []models.Bill
+		if err := tx.Where("split_id = ?", splitID).Find(&bills).Error; err != nil {
+			return err
+		}
+		for _, bill := range bills {
+			if err := owe(bill.Amount, models.Payment{BillID: &bill.ID}); err != nil {
+				return err
+			}
+		}
+	}
+	if owed > 0 && method == "" {
+		return &orderError{http.StatusConflict, "The tab is not paid", fmt.Sprintf("%d so'm is unpaid; pass the method it was paid with", owed)}
+	}
+	return nil
+}
+
+// CloseTab ends a table's visit: every served order is marked paid, with a
+// cash or card payment for whatever was still owed, the table session is
+// closed so the table is free, and table_closed is sent to the table room.
+func CloseTab(w http.ResponseWriter, r *http.Request) {
+	var input dto.CloseTabInput
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+			return
+		}
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	actorID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	var session models.TableSession
+	var paid []models.Order
+	var tab dto.TabResponse
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("table_id = ? AND closed_at IS NULL", mux.Vars(r)["id"]).
+			First(&session).Error; err != nil {
+			return err
+		}
+		var orders []models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("table_session_id = ? AND status NOT IN ?", session.ID, []models.OrderStatus{models.OrderCancelled, models.OrderRejected}).
+			Order("created_at").
+			Find(&orders).Error; err != nil {
+			return err
+		}
+		for _, order := range orders {
+			if order.Status != models.OrderServed && order.Status != models.OrderPaid {
+				return &orderError{http.StatusConflict, "The tab has open orders", fmt.Sprintf("Order %s is %s", order.OrderId, order.Status)}
+			}
+		}
+		if err := settleTab(tx, r, orders, input.Method, &actorID); err != nil {
+			return err
+		}
+		for i := range orders {
+			if orders[i].Status == models.OrderPaid {
+				continue
+			}
+			if err := setOrderStatus(tx, r, &orders[i], models.OrderPaid, "", &actorID); err != nil {
+				return err
+			}
+			paid = append(paid, orders[i])
+		}
+		before := dto.NewTableSession(session)
+		if err := models.CloseTableSession(tx, &session, &actorID); err != nil {
+			return err
+		}
+		if err := audit(tx, r, models.AuditUpdate, "table_session", session.ID, before, dto.NewTableSession(session)); err != nil {
+			return err
+		}
+		var err error
+		tab, err = loadTab(tx, session)
+		return err
+	})
+	var refused *orderError
+	switch {
+	case errors.As(err, &refused):
+		utils.RespondWithError(w, refused.status, refused.message, refused.detail)
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.RespondWithError(w, http.StatusNotFound, "Table has no open session", err.Error())
+		return
+	case err != nil:
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to close the tab", err.Error())
+		return
+	}
+	for _, order := range paid {
+		models.DB.Preload("Table").First(&order, "ID = ?", order.ID)
+		broadcastOrder("status_updated", order)
+	}
+	message := utils.WebSocketMessage{Event: "table_closed", Data: tab}
+	HubInstance.BroadcastToRoom(session.ID, message)
+	HubInstance.BroadcastToRoom(staffRoom, message)
+	HubInstance.CloseRoom(session.ID)
+	utils.RespondWithSuccess(w, http.StatusOK, "Tab closed", tab)
+}
@@ -5,25 +5,34 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
 	"github.com/davronkhamdamov/restaraunt_backend/models"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
 	"github.com/gorilla/mux"
 	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
 )
 
 func CreateTable(w http.ResponseWriter, r *http.Request) {
-	table := models.Table{}
-	if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
+	input := dto.TableInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(table); err != nil {
+	if err := validate.Struct(input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	dbResult := models.DB.Create(&table)
-	if dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Table already exists", dbResult.Error.Error())
+	table := models.Table{}
+	input.Apply(&table)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&table).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "table", table.ID, nil, dto.NewTable(table))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Table already exists", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusCreated, "Table created successfully", nil)
@@ -35,7 +44,7 @@ func GetTables(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "OK", table)
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewTableList(table))
 }
 func GetTable(w http.ResponseWriter, r *http.Request) {
 	table := models.Table{}
@@ -45,7 +54,7 @@ func GetTable(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusNotFound, "Table not found", dbResult.Error.Error())
 		return
 	}
-	url := fmt.Sprintf("https://m-menu-front.vercel.app/uz/%s", tableID)
+	url := fmt.Sprintf("https://m-menu-front.vercel.app/uz/%s?key=%s", tableID, table.QRKey)
 
 	png, err := qrcode.Encode(url, qrcode.Medium, 256)
 	if err != nil {
@@ -63,7 +72,7 @@ func GetOneTable(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusNotFound, "Table not found", dbResult.Error.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "ok", table)
+	utils.RespondWithSuccess(w, http.StatusOK, "ok", dto.NewTable(table))
 }
 func UpdateTable(w http.ResponseWriter, r *http.Request) {
 	table := models.Table{}
@@ -73,16 +82,25 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusNotFound, "Table not found", dbResult.Error.Error())
 		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	input := dto.TableInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(table); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if dbResult := models.DB.Save(&table); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	before := dto.NewTable(table)
+	input.Apply(&table)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&table).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "table", table.ID, before, dto.NewTable(table))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusOK, "Table updated successfully", nil)
@@ -96,8 +114,14 @@ func DeleteTable(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusNotFound, "Table not found", dbResult.Error.Error())
 		return
 	}
-	if dbResult := models.DB.Delete(&table); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&table).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditDelete, "table", table.ID, dto.NewTable(table), nil)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusOK, "Table deleted successfully", nil)
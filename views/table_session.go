@@ -0,0 +1,128 @@
+package views
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// openTableSession returns the open session of the table, closing it first
+// when it went idle, or starts a new one.
+func openTableSession(tx *gorm.DB, tableID string) (models.TableSession, error) {
+	now := time.Now()
+	var session models.TableSession
+	dbResult := tx.Where("table_id = ? AND closed_at IS NULL", tableID).Limit(1).Find(&session)
+	if dbResult.Error != nil {
+		return session, dbResult.Error
+	}
+	if dbResult.RowsAffected > 0 {
+		if session.Active(now, middleware.TableSessionIdle) {
+			return session, tx.Model(&session).Update("last_seen_at", now).Error
+		}
+		if err := models.CloseTableSession(tx, &session, nil); err != nil {
+			return session, err
+		}
+	}
+	session = models.TableSession{TableID: tableID, LastSeenAt: now}
+	return session, tx.Create(&session).Error
+}
+
+// OpenTableSession is called by the menu page the table QR code points to.
+// Guests scanning the same table share the open session.
+func OpenTableSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var input dto.OpenTableSessionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	var table models.Table
+	if dbResult := models.DB.Where("ID = ?", vars["id"]).First(&table); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Table not found", dbResult.Error.Error())
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(input.Key), []byte(table.QRKey)) != 1 {
+		utils.RespondWithError(w, http.StatusForbidden, "Invalid table code", "Scan the QR code on the table again")
+		return
+	}
+	var session models.TableSession
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		session, err = openTableSession(tx, table.ID)
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// Another guest at the same table opened the session at the same time.
+		err = models.DB.Where("table_id = ? AND closed_at IS NULL", table.ID).First(&session).Error
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to open table session", err.Error())
+		return
+	}
+	token, err := utils.Tokens.SignGuest(&utils.GuestClaims{TableID: table.ID, TableSessionID: session.ID})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate token", err.Error())
+		return
+	}
+	session.Table = table
+	utils.RespondWithSuccess(w, http.StatusOK, "Table session opened", dto.TableSessionTokenResponse{
+		Token:     token,
+		ExpiresIn: int64(utils.Tokens.GuestTTL().Seconds()),
+		Session:   dto.NewTableSession(session),
+	})
+}
+
+func GetTableSessions(w http.ResponseWriter, r *http.Request) {
+	var sessions []models.TableSession
+	if dbResult := models.DB.
+		Preload("Table").
+		Where("closed_at IS NULL AND last_seen_at > ?", time.Now().Add(-middleware.TableSessionIdle)).
+		Order("created_at").
+		Find(&sessions); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "OK", dto.NewTableSessionList(sessions))
+}
+
+// CloseTableSession is used by staff when the guests leave. Their tokens stop
+// working and the next scan of the QR code opens a new session.
+func CloseTableSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var session models.TableSession
+	if dbResult := models.DB.Where("table_id = ? AND closed_at IS NULL", vars["id"]).First(&session); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Table has no open session", dbResult.Error.Error())
+		return
+	}
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	before := dto.NewTableSession(session)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.CloseTableSession(tx, &session, &userID); err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "table_session", session.ID, before, dto.NewTableSession(session))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	HubInstance.BroadcastToRoom(session.ID, utils.WebSocketMessage{
+		Event: "session_closed",
+		Data:  dto.NewTableSession(session),
+	})
+	HubInstance.CloseRoom(session.ID)
+	utils.RespondWithSuccess(w, http.StatusOK, "Table session closed", dto.NewTableSession(session))
+}
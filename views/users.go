@@ -2,55 +2,123 @@ package views
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"regexp"
 
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
 	"github.com/davronkhamdamov/restaraunt_backend/models"
 	"github.com/davronkhamdamov/restaraunt_backend/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
-var validate = validator.New()
+var validate = newValidator()
+
+// pinPattern is a staff PIN: four to six digits and nothing else, unlike the
+// numeric tag, which also takes signs and decimal points.
+var pinPattern = regexp.MustCompile(`^[0-9]{4,6}$`)
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	err := v.RegisterValidation("pin", func(fl validator.FieldLevel) bool {
+		return pinPattern.MatchString(fl.Field().String())
+	})
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// staffAudit flags secret changes in the audit diff without logging hashes.
+type staffAudit struct {
+	dto.StaffResponse
+	PasswordChanged bool `json:"password_changed,omitempty"`
+	PinChanged      bool `json:"pin_changed,omitempty"`
+}
+
+func roleExists(w http.ResponseWriter, roleID string) bool {
+	err := models.DB.Select("id").First(&models.Role{}, "ID = ?", roleID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Role not found", roleID)
+		return false
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return false
+	}
+	return true
+}
 
 func CreateStaff(w http.ResponseWriter, r *http.Request) {
-	user := models.User{}
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	input := dto.CreateStaffInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
-	if err := validate.Struct(user); err != nil {
+	if err := validate.Struct(input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
+	if err := utils.Passwords.Check(input.Password, input.Login); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Password does not meet the policy", err.Error())
+		return
+	}
+	if input.RoleID != nil && !roleExists(w, *input.RoleID) {
+		return
+	}
+	user := input.Model()
+	if user.RoleID == nil {
+		var staffRole models.Role
+		if dbResult := models.DB.Where("name = ?", models.StaffRoleName).First(&staffRole); dbResult.Error != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
+			return
+		}
+		user.RoleID = &staffRole.ID
+	}
 	var err error
-	user.Password, err = utils.HashPassword(user.Password)
+	user.Password, err = utils.HashPassword(input.Password)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
 		return
 	}
-	if dbResult := models.DB.Create(&user); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", dbResult.Error.Error())
+	if input.Pin != "" {
+		if user.PinHash, err = utils.HashPassword(input.Pin); err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+			return
+		}
+	}
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditCreate, "staff", user.ID, nil, dto.NewStaff(user))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
 	utils.RespondWithSuccess(w, http.StatusCreated, "User created successfully", nil)
 }
 func GetStaffs(w http.ResponseWriter, r *http.Request) {
 	var staff []models.User
-	if dbResult := models.DB.Order("created_at DESC").Find(&staff); dbResult.Error != nil {
+	if dbResult := models.DB.Preload("Role").Order("created_at DESC").Find(&staff); dbResult.Error != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Staff retrieved successfully", staff)
+	utils.RespondWithSuccess(w, http.StatusOK, "Staff retrieved successfully", dto.NewStaffList(staff))
 }
 func GetStaff(w http.ResponseWriter, r *http.Request) {
 	var staff models.User
 	vars := mux.Vars(r)
 	tableID := vars["id"]
-	if dbResult := models.DB.Where("ID = ?", tableID).First(&staff); dbResult.Error != nil {
+	if dbResult := models.DB.Preload("Role").Where("ID = ?", tableID).First(&staff); dbResult.Error != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", dbResult.Error.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Staff retrieved successfully", staff)
+	utils.RespondWithSuccess(w, http.StatusOK, "Staff retrieved successfully", dto.NewStaff(staff))
 }
 func UpdateStaff(w http.ResponseWriter, r *http.Request) {
 	var existingStaff models.User
@@ -62,21 +130,28 @@ func UpdateStaff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var updatedData models.User
+	var updatedData dto.UpdateStaffInput
 	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
 
 	if err := validate.Struct(updatedData); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+		return
+	}
+	if updatedData.RoleID != nil && !roleExists(w, *updatedData.RoleID) {
 		return
 	}
 
-	existingStaff.Login = updatedData.Login
-	existingStaff.Role = updatedData.Role
+	before := dto.NewStaff(existingStaff)
+	updatedData.Apply(&existingStaff)
 
 	if updatedData.Password != "" {
+		if err := utils.Passwords.Check(updatedData.Password, existingStaff.Login); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Password does not meet the policy", err.Error())
+			return
+		}
 		hashedPassword, err := utils.HashPassword(updatedData.Password)
 		if err != nil {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
@@ -84,16 +159,43 @@ func UpdateStaff(w http.ResponseWriter, r *http.Request) {
 		}
 		existingStaff.Password = hashedPassword
 	}
+	if updatedData.Pin != "" {
+		hashedPin, err := utils.HashPassword(updatedData.Pin)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+			return
+		}
+		existingStaff.PinHash = hashedPin
+	}
 
-	if dbResult := models.DB.Save(&existingStaff); dbResult.Error != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", dbResult.Error.Error())
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingStaff).Error; err != nil {
+			return err
+		}
+		if updatedData.Password != "" {
+			if err := models.RevokeUserSessions(tx, existingStaff.ID); err != nil {
+				return err
+			}
+		}
+		after := staffAudit{
+			StaffResponse:   dto.NewStaff(existingStaff),
+			PasswordChanged: updatedData.Password != "",
+			PinChanged:      updatedData.Pin != "",
+		}
+		return audit(tx, r, models.AuditUpdate, "staff", existingStaff.ID, before, after)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
+	if updatedData.Password != "" {
+		HubInstance.CloseRoom(existingStaff.ID)
+	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, "Staff updated successfully", existingStaff)
+	utils.RespondWithSuccess(w, http.StatusOK, "Staff updated successfully", dto.NewStaff(existingStaff))
 }
 func Login(w http.ResponseWriter, r *http.Request) {
-	user := models.Login{}
+	user := dto.LoginInput{}
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
@@ -102,19 +204,182 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
 		return
 	}
+	ip := utils.ClientIP(r)
+	wait, err := reserveLogin(user.Login, ip)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	if wait > 0 {
+		recordLoginEvent(r, user.Login, nil, false, "throttled")
+		respondTooManyAttempts(w, wait)
+		return
+	}
 	var dbUser models.User
-	if dbResult := models.DB.Where("login = ?", user.Login).First(&dbUser); dbResult.Error != nil {
+	if dbResult := models.DB.Preload("Role.Permissions").Where("login = ?", user.Login).First(&dbUser); dbResult.Error != nil {
+		recordLoginEvent(r, user.Login, nil, false, "unknown_login")
 		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid login or password", "")
 		return
 	}
 	if err := utils.CheckPassword(dbUser.Password, user.Password); err != nil {
+		recordLoginEvent(r, user.Login, &dbUser.ID, false, "bad_password")
 		utils.RespondWithError(w, http.StatusUnauthorized, "Invalid login or password", "")
 		return
 	}
-	token, err := utils.CreateToken(dbUser.ID)
+	loginSucceeded(user.Login, ip)
+	if !dbUser.Active {
+		recordLoginEvent(r, user.Login, &dbUser.ID, false, "inactive")
+		utils.RespondWithError(w, http.StatusForbidden, "Account is deactivated", "")
+		return
+	}
+	recordLoginEvent(r, user.Login, &dbUser.ID, true, "ok")
+	tokens, err := openSession(r, dbUser.ID)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to generate token", err.Error())
 		return
 	}
-	utils.RespondWithSuccess(w, http.StatusOK, "Login successful", map[string]string{"role": dbUser.Role.String(), "token": token})
+	response := dto.LoginResponse{Permissions: []string{}, TokenResponse: tokens}
+	if dbUser.Role != nil {
+		response.Role = dbUser.Role.Name
+		response.Permissions = dbUser.Role.PermissionCodes()
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Login successful", response)
+}
+
+// DeactivateStaff blocks the user, revokes their sessions and hands their
+// open orders to another user or unassigns them, returning accepted ones to
+// the pending pool.
+func DeactivateStaff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	staffID := vars["id"]
+	if staffID == r.Context().Value(middleware.UserIDKey) {
+		utils.RespondWithError(w, http.StatusBadRequest, "You cannot deactivate yourself", nil)
+		return
+	}
+	var request dto.DeactivateStaffInput
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload", err.Error())
+			return
+		}
+	}
+	var staff models.User
+	if dbResult := models.DB.Where("ID = ?", staffID).First(&staff); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Staff not found", dbResult.Error.Error())
+		return
+	}
+	if request.ReassignTo != nil {
+		var target models.User
+		if dbResult := models.DB.Where("ID = ?", *request.ReassignTo).First(&target); dbResult.Error != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Staff to reassign orders to not found", dbResult.Error.Error())
+			return
+		}
+		if !target.Active || target.ID == staff.ID {
+			utils.RespondWithError(w, http.StatusBadRequest, "Orders can only be reassigned to another active staff member", nil)
+			return
+		}
+	}
+
+	var orders []models.Order
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		before := dto.NewStaff(staff)
+		if err := tx.Model(&staff).Update("active", false).Error; err != nil {
+			return err
+		}
+		if err := audit(tx, r, models.AuditUpdate, "staff", staff.ID, before, dto.NewStaff(staff)); err != nil {
+			return err
+		}
+		if err := models.RevokeUserSessions(tx, staff.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND status IN ?", staff.ID, models.OpenOrderStatuses).Find(&orders).Error; err != nil {
+			return err
+		}
+		adminID, _ := r.Context().Value(middleware.UserIDKey).(string)
+		for i := range orders {
+			before := dto.NewOrder(orders[i])
+			orders[i].UserID = request.ReassignTo
+			// Accepted orders nobody started on go back to the queue. This is
+			// the one status change made outside models.OrderTransitions.
+			if request.ReassignTo == nil && orders[i].Status == models.OrderAccepted {
+				orders[i].Status = models.OrderPending
+				if err := models.RecordOrderStatus(tx, orders[i].ID, models.OrderAccepted, models.OrderPending, &adminID); err != nil {
+					return err
+				}
+			}
+			if err := tx.Select("user_id", "status").Save(&orders[i]).Error; err != nil {
+				return err
+			}
+			if err := audit(tx, r, models.AuditUpdate, "order", orders[i].ID, before, dto.NewOrder(orders[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	HubInstance.CloseRoom(staff.ID)
+
+	for _, order := range orders {
+		if request.ReassignTo != nil {
+			HubInstance.BroadcastToRoom(*request.ReassignTo, utils.WebSocketMessage{Event: "order_assigned", Data: dto.NewOrder(order)})
+		}
+		HubInstance.BroadcastToRoom(staffRoom, utils.WebSocketMessage{Event: "status_updated", Data: dto.NewOrder(order)})
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Staff deactivated successfully", map[string]any{"orders": dto.NewOrderList(orders)})
+}
+func ActivateStaff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var staff models.User
+	if dbResult := models.DB.Where("ID = ?", vars["id"]).First(&staff); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Staff not found", dbResult.Error.Error())
+		return
+	}
+	before := dto.NewStaff(staff)
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&staff).Update("active", true).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditUpdate, "staff", staff.ID, before, dto.NewStaff(staff))
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Staff activated successfully", nil)
+}
+
+// DeleteStaff only removes users who never handled an order; everyone else
+// has to be deactivated so Order.UserID keeps pointing at them.
+func DeleteStaff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	staffID := vars["id"]
+	if staffID == r.Context().Value(middleware.UserIDKey) {
+		utils.RespondWithError(w, http.StatusBadRequest, "You cannot delete yourself", nil)
+		return
+	}
+	var staff models.User
+	if dbResult := models.DB.Where("ID = ?", staffID).First(&staff); dbResult.Error != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Staff not found", dbResult.Error.Error())
+		return
+	}
+	var orders int64
+	models.DB.Model(&models.Order{}).Where("user_id = ?", staff.ID).Count(&orders)
+	if orders > 0 {
+		utils.RespondWithError(w, http.StatusConflict, "Staff has order history, deactivate instead", nil)
+		return
+	}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&staff).Error; err != nil {
+			return err
+		}
+		return audit(tx, r, models.AuditDelete, "staff", staff.ID, dto.NewStaff(staff), nil)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Something went wrong", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusOK, "Staff deleted successfully", nil)
 }
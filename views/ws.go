@@ -0,0 +1,115 @@
+package views
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/davronkhamdamov/restaraunt_backend/dto"
+	"github.com/davronkhamdamov/restaraunt_backend/middleware"
+	"github.com/davronkhamdamov/restaraunt_backend/models"
+	"github.com/davronkhamdamov/restaraunt_backend/utils"
+	"gorm.io/gorm"
+)
+
+// staffRoom receives the events every logged in user sees, such as new
+// orders. Guests only join the room of their table session.
+const staffRoom = "staff"
+
+// wsSweepInterval is how often sockets of sessions that expired without
+// anyone closing them are dropped.
+const wsSweepInterval = time.Minute
+
+var wsTickets = utils.NewTicketStore(30 * time.Second)
+
+func InitWebSocket() error {
+	store, err := utils.NewTicketStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	wsTickets = store
+	return nil
+}
+
+// IssueWebSocketTicket returns a ticket for /ws?ticket=. Staff authenticate
+// with the usual headers and get a ticket for their own room; guests send
+// their table token and get one for the room of their table session, so they
+// stop hearing about the table once the session ends.
+func IssueWebSocketTicket(w http.ResponseWriter, r *http.Request) {
+	var subject utils.TicketSubject
+	if tokenString := r.Header.Get("Authorization"); tokenString != "" {
+		user, session, err := middleware.Authenticate(tokenString, r.Header.Get(middleware.DeviceTokenHeader))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid token", err.Error())
+			return
+		}
+		subject = utils.TicketSubject{Kind: utils.TicketUser, UserID: user.ID, SessionID: session.ID}
+	} else {
+		session, err := middleware.AuthenticateTable(r.Header.Get(middleware.TableTokenHeader))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid table session", err.Error())
+			return
+		}
+		subject = utils.TicketSubject{Kind: utils.TicketTableSession, SessionID: session.ID}
+	}
+	ticket, err := wsTickets.Issue(subject)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to issue ticket", err.Error())
+		return
+	}
+	utils.RespondWithSuccess(w, http.StatusCreated, "Ticket issued", dto.WSTicketResponse{
+		Ticket:    ticket,
+		ExpiresIn: int64(wsTickets.TTL().Seconds()),
+	})
+}
+
+// broadcastToGuests sends message to the table sessions the orders were
+// placed in. Orders from before table sessions reach no guest.
+func broadcastToGuests(message utils.WebSocketMessage, orders ...models.Order) {
+	sent := map[string]bool{}
+	for _, order := range orders {
+		if order.TableSessionID == nil || sent[*order.TableSessionID] {
+			continue
+		}
+		sent[*order.TableSessionID] = true
+		HubInstance.BroadcastToRoom(*order.TableSessionID, message)
+	}
+}
+
+// closeEndedSessions disconnects the sockets of table sessions that were
+// closed or went idle and of staff sessions that were revoked or expired.
+func closeEndedSessions() {
+	now := time.Now()
+	closeEnded(utils.TicketTableSession, models.DB.Model(&models.TableSession{}).
+		Where("closed_at IS NULL AND last_seen_at > ?", now.Add(-middleware.TableSessionIdle)))
+	closeEnded(utils.TicketUser, models.DB.Model(&models.Session{}).
+		Where("revoked_at IS NULL AND expires_at > ?", now))
+}
+
+// closeEnded closes the rooms of the connected sessions of kind that active
+// no longer finds.
+func closeEnded(kind string, active *gorm.DB) {
+	ids := HubInstance.SessionIDs(kind)
+	if len(ids) == 0 {
+		return
+	}
+	var alive []string
+	if err := active.Where("id IN ?", ids).Pluck("id", &alive).Error; err != nil {
+		log.Println("Failed to check WebSocket sessions:", err)
+		return
+	}
+	for _, id := range ids {
+		if !slices.Contains(alive, id) {
+			HubInstance.CloseRoom(id)
+		}
+	}
+}
+
+// SweepWebSockets drops the sockets of expired sessions every
+// wsSweepInterval. Closing or revoking a session drops its sockets at once.
+func SweepWebSockets() {
+	for range time.Tick(wsSweepInterval) {
+		closeEndedSessions()
+	}
+}